@@ -0,0 +1,77 @@
+package msgr
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// Attachment is a file attached to a mail, from Content or read from Reader.
+// Set ContentID to show an image inline, referenced in HTML templates with
+// the cid helper such as <img src="{{ cid "logo.png" }}">.
+type Attachment struct {
+	Filename    string
+	ContentType string // Detected from the filename or content when empty
+	Content     []byte
+	Reader      io.Reader `json:"-"` // Read when Content is nil
+	ContentID   string
+}
+
+// resolveAttachments reads the attachment readers into their content and
+// detects content types, so the send can be queued or retried.
+func resolveAttachments(attachments []Attachment) ([]Attachment, error) {
+	if len(attachments) == 0 {
+		return attachments, nil
+	}
+
+	resolved := make([]Attachment, len(attachments))
+	for i, attachment := range attachments {
+		if attachment.Filename == "" {
+			return nil, fmt.Errorf("%w: missing filename", ErrInvalidAttachment)
+		}
+
+		if attachment.Content == nil && attachment.Reader != nil {
+			content, err := io.ReadAll(attachment.Reader)
+			if err != nil {
+				return nil, fmt.Errorf("attachment %s: %w", attachment.Filename, err)
+			}
+			attachment.Content = content
+		}
+		attachment.Reader = nil
+
+		if attachment.ContentType == "" {
+			attachment.ContentType = mime.TypeByExtension(
+				filepath.Ext(attachment.Filename),
+			)
+		}
+		if attachment.ContentType == "" {
+			attachment.ContentType = http.DetectContentType(attachment.Content)
+		}
+
+		resolved[i] = attachment
+	}
+
+	return resolved, nil
+}
+
+// providerAttachments converts resolved attachments for the mail providers
+func providerAttachments(attachments []Attachment) []provider.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	converted := make([]provider.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		converted[i] = provider.Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Content:     attachment.Content,
+			ContentID:   attachment.ContentID,
+		}
+	}
+	return converted
+}
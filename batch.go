@@ -0,0 +1,384 @@
+package msgr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// Number of recipients composed and sent concurrently when no limit is set
+const DefaultBatchConcurrency = 10
+
+// BatchRecipient is a recipient of a batch send, see SendOpts for the fields
+type BatchRecipient struct {
+	MailTo   string
+	SMSTo    string
+	PushTo   []provider.PushDevice
+	Data     MessageData
+	Locale   string
+	Timezone string // IANA name of the recipient time zone, for quiet hours
+}
+
+type SendBatchOpts struct {
+	MessageName string
+	Recipients  []BatchRecipient
+}
+
+// BatchResult holds the result for each recipient, in the same order as
+// SendBatchOpts.Recipients. Like SendResult, it satisfies error.
+type BatchResult struct {
+	MessageName string
+	Results     []*SendResult
+	StartedAt   time.Time
+	Duration    time.Duration
+}
+
+// Failed returns the number of recipients with at least one failed channel
+func (r *BatchResult) Failed() int {
+	failed := 0
+	for _, res := range r.Results {
+		if res.Failed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Err returns the result as an error if any recipient failed, nil otherwise
+func (r *BatchResult) Err() error {
+	if r.Failed() == 0 {
+		return nil
+	}
+	return r
+}
+
+func (r *BatchResult) Error() string {
+	return fmt.Sprintf(
+		"send batch %s failed for %d of %d recipients",
+		r.MessageName, r.Failed(), len(r.Results),
+	)
+}
+
+// Unwrap returns the result of each failed recipient
+func (r *BatchResult) Unwrap() []error {
+	var errs []error
+	for _, res := range r.Results {
+		if err := res.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// SendBatch sends the same message to many recipients, each with their own
+// data. Recipients are composed and sent concurrently, and mail is sent using
+// the provider batch endpoint when it implements provider.BatchMailProvider.
+// With middleware, each recipient is sent through it like SendWithResult.
+func (msgr *Messenger) SendBatch(
+	ctx context.Context, opts SendBatchOpts,
+) (*BatchResult, error) {
+	msg, err := msgr.GetMessage(opts.MessageName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{
+		MessageName: opts.MessageName,
+		Results:     make([]*SendResult, len(opts.Recipients)),
+		StartedAt:   time.Now(),
+	}
+
+	sendOpts := make([]SendOpts, len(opts.Recipients))
+	for i, recipient := range opts.Recipients {
+		sendOpts[i] = SendOpts{
+			MessageName: opts.MessageName,
+			MailTo:      recipient.MailTo,
+			SMSTo:       recipient.SMSTo,
+			PushTo:      recipient.PushTo,
+			Data:        recipient.Data,
+			Locale:      msgr.locale(recipient.Locale),
+			Timezone:    recipient.Timezone,
+		}
+
+		result.Results[i] = &SendResult{
+			MessageName: opts.MessageName,
+			Fallback:    msg.deliveryPolicy.sequential(),
+			StartedAt:   time.Now(),
+		}
+	}
+
+	// Middleware wraps each send, so recipients are sent one by one through
+	// it instead of using the batch endpoint
+	if msgr.hasMiddleware() {
+		msgr.forEachRecipient(len(sendOpts), func(i int) {
+			res, err := msgr.SendWithResult(ctx, sendOpts[i])
+			if res != nil {
+				result.Results[i] = res
+			} else if err != nil {
+				sends := msgr.channelSends(sendOpts[i])
+				failChannels(result.Results[i], sends, err)
+			}
+		})
+
+		result.Duration = time.Since(result.StartedAt)
+		return result, result.Err()
+	}
+
+	// Channels in quiet hours are deferred for each recipient, and left out
+	// of the sends below
+	msgr.forEachRecipient(len(sendOpts), func(i int) {
+		sendOpts[i] = msgr.deferBatchQuiet(
+			ctx, msg, sendOpts[i], result.Results[i],
+		)
+	})
+
+	// Mail results by recipient index, when sent via the batch endpoint.
+	// Channels sent one at a time by the delivery policy are sent on their own.
+	var mailResults []ChannelResult
+	var batchMail provider.BatchMailProvider
+	isBatch := false
+	if len(msgr.mailProviders) > 0 && msg.deliveryPolicy.batchMail() {
+		batchMail, isBatch = msgr.mailProviders[0].(provider.BatchMailProvider)
+	}
+	if isBatch {
+		mailResults = msgr.sendMailBatch(ctx, msg, sendOpts, batchMail)
+	}
+
+	msgr.forEachRecipient(len(sendOpts), func(i int) {
+		res := result.Results[i]
+
+		sends := msgr.channelSends(sendOpts[i])
+		if isBatch {
+			sends = slices.DeleteFunc(sends, func(cs channelSend) bool {
+				return cs.channel == MailChannel
+			})
+		}
+
+		if isBatch && sendOpts[i].MailTo != "" {
+			res.Channels = append(res.Channels, mailResults[i])
+		}
+		res.Channels = append(
+			res.Channels, msgr.deliver(ctx, msg, sendOpts[i], sends)...,
+		)
+
+		res.Duration = time.Since(res.StartedAt)
+	})
+
+	result.Duration = time.Since(result.StartedAt)
+
+	return result, result.Err()
+}
+
+// deferBatchQuiet defers the channels of a recipient in quiet hours like
+// deferQuiet. When they cannot be deferred, the channels fail instead of
+// being sent during quiet hours.
+func (msgr *Messenger) deferBatchQuiet(
+	ctx context.Context, msg *Message, opts SendOpts, res *SendResult,
+) SendOpts {
+	now, err := msgr.deferQuiet(ctx, msg, opts, res)
+	if err == nil {
+		return now
+	}
+
+	failChannels(res, msgr.channelSends(opts), err)
+
+	for _, channel := range defaultChannelOrder {
+		setRecipient(&opts, channel, false)
+	}
+	return opts
+}
+
+// failChannels records every channel of the sends as failed with err
+func failChannels(res *SendResult, sends []channelSend, err error) {
+	for _, cs := range sends {
+		channelRes := ChannelResult{Channel: cs.channel, StartedAt: res.StartedAt}
+		channelRes.finish(err)
+		res.Channels = append(res.Channels, channelRes)
+	}
+}
+
+// sendMailBatch composes the mail of every recipient and sends them in a
+// single batch. Mails that still fail with a retryable error are sent to the
+// failover providers one by one. It returns the mail result by recipient index.
+func (msgr *Messenger) sendMailBatch(
+	ctx context.Context, msg *Message, sendOpts []SendOpts,
+	batchMail provider.BatchMailProvider,
+) []ChannelResult {
+	startedAt := time.Now()
+	results := make([]ChannelResult, len(sendOpts))
+	events := make([]*HookEvent, len(sendOpts))
+	composed := make([]*provider.MailSendOpts, len(sendOpts))
+
+	msgr.forEachRecipient(len(sendOpts), func(i int) {
+		if sendOpts[i].MailTo == "" {
+			return
+		}
+
+		results[i] = ChannelResult{
+			Channel: MailChannel, Provider: batchMail.Name(), StartedAt: startedAt,
+		}
+
+		opts := sendOpts[i].clone()
+		events[i] = &HookEvent{
+			MessageName: opts.MessageName,
+			Channel:     MailChannel,
+			Opts:        &opts,
+			Result:      &results[i],
+		}
+
+		err := msgr.runHooks(ctx, events[i], beforeCompose)
+		if err == nil {
+			composed[i], err = msgr.prepareMail(ctx, msg, events[i])
+		}
+		results[i].Error = err
+	})
+
+	// Recipient index of each mail in the batch
+	var indexes []int
+	var batch []provider.MailSendOpts
+	for i, providerOpts := range composed {
+		if providerOpts != nil {
+			indexes = append(indexes, i)
+			batch = append(batch, *providerOpts)
+		}
+	}
+
+	// Rate limits are taken for each mail, those over the limit are not sent
+	limitErrs, waited := msgr.channelLimiters[MailChannel].takeEach(
+		ctx, len(batch),
+	)
+	var allowedIndexes []int
+	var allowedBatch []provider.MailSendOpts
+	for i, index := range indexes {
+		results[index].RateLimitWait = waited
+		results[index].Error = limitErrs[i]
+		if limitErrs[i] == nil {
+			allowedIndexes = append(allowedIndexes, index)
+			allowedBatch = append(allowedBatch, batch[i])
+		}
+	}
+	indexes, batch = allowedIndexes, allowedBatch
+	sentIndexes := indexes
+
+	policy := msgr.retryPolicy(MailChannel)
+
+	// Mails that failed with a retryable error are sent again in a new batch
+	for attempt := 1; len(indexes) > 0; attempt++ {
+		var batchResults []provider.MailBatchResult
+		var batchErr error
+
+		// Mails over the provider limit fail, and are retried
+		limitErrs, waited := msgr.providerLimiters[batchMail.Name()].takeEach(
+			ctx, len(batch),
+		)
+		var allowedBatch []provider.MailSendOpts
+		for i, opts := range batch {
+			if limitErrs[i] == nil {
+				allowedBatch = append(allowedBatch, opts)
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			batchErr = err
+		} else if len(allowedBatch) > 0 {
+			batchResults, batchErr = batchMail.SendBatch(ctx, allowedBatch)
+		}
+
+		// Position of each allowed mail in batchResults
+		sent := 0
+		for i, index := range indexes {
+			results[index].RateLimitWait += waited
+			results[index].Attempts = attempt
+			switch {
+			case limitErrs[i] != nil:
+				results[index].Error = limitErrs[i]
+				continue
+			case sent < len(batchResults):
+				results[index].MessageID = batchResults[sent].MessageID
+				results[index].Error = batchResults[sent].Error
+			default:
+				results[index].Error = batchErr
+			}
+			sent++
+		}
+
+		var retryIndexes []int
+		var retryBatch []provider.MailSendOpts
+		for i, index := range indexes {
+			if provider.IsRetryable(results[index].Error) {
+				retryIndexes = append(retryIndexes, index)
+				retryBatch = append(retryBatch, batch[i])
+			}
+		}
+		indexes, batch = retryIndexes, retryBatch
+
+		if len(indexes) == 0 || attempt >= policy.attempts() {
+			break
+		}
+
+		if err := policy.wait(ctx, attempt); err != nil {
+			break
+		}
+	}
+
+	for _, index := range sentIndexes {
+		results[index].ProviderAttempts = []ProviderAttempt{{
+			Provider: batchMail.Name(),
+			Attempts: results[index].Attempts,
+			Error:    results[index].Error,
+		}}
+	}
+
+	if failovers := msgr.mailProviders[1:]; len(failovers) > 0 {
+		msgr.forEachRecipient(len(indexes), func(i int) {
+			index := indexes[i]
+			results[index].Error = msgr.deliverMail(
+				ctx, failovers, *composed[index], &results[index],
+			)
+		})
+	}
+
+	for i, event := range events {
+		if event == nil {
+			continue
+		}
+
+		err := results[i].Error
+		results[i].Error = nil
+		results[i].finish(err)
+
+		msgr.afterDeliver(ctx, event)
+	}
+
+	return results
+}
+
+// forEachRecipient calls fn for each index up to n, with at most the batch
+// concurrency calls running at a time.
+func (msgr *Messenger) forEachRecipient(n int, fn func(i int)) {
+	concurrency := msgr.batchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
@@ -1,5 +1,7 @@
 package msgr
 
+import "maps"
+
 type Channel string
 
 const (
@@ -11,4 +13,53 @@ const (
 type MailChannelOpts struct {
 	From    string
 	ReplyTo string
+	// Headers and metadata are merged with those of the client and the send,
+	// while the tag and stream are overridden by them when set
+	Headers       map[string]string
+	Tag           string
+	Metadata      map[string]string
+	MessageStream string
+}
+
+// equal reports whether the options are the same. Nil and empty maps are
+// equal.
+func (o MailChannelOpts) equal(other MailChannelOpts) bool {
+	return o.From == other.From && o.ReplyTo == other.ReplyTo &&
+		o.Tag == other.Tag && o.MessageStream == other.MessageStream &&
+		maps.Equal(o.Headers, other.Headers) &&
+		maps.Equal(o.Metadata, other.Metadata)
+}
+
+// merge returns the options overridden by those set in other, with headers
+// and metadata merged by key
+func (o MailChannelOpts) merge(other MailChannelOpts) MailChannelOpts {
+	merged := o
+	merged.Headers = mergeStrings(o.Headers, other.Headers)
+	merged.Metadata = mergeStrings(o.Metadata, other.Metadata)
+
+	for _, field := range [][2]*string{
+		{&merged.From, &other.From},
+		{&merged.ReplyTo, &other.ReplyTo},
+		{&merged.Tag, &other.Tag},
+		{&merged.MessageStream, &other.MessageStream},
+	} {
+		if *field[1] != "" {
+			*field[0] = *field[1]
+		}
+	}
+
+	return merged
+}
+
+func mergeStrings(base, other map[string]string) map[string]string {
+	if len(other) == 0 {
+		return base
+	}
+
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	maps.Copy(merged, other)
+	return merged
 }
@@ -15,9 +15,10 @@ type MailContents struct {
 }
 
 type ComposeMailOpts struct {
-	Message Message
-	Locale  string
-	Data    MessageData
+	Message        Message
+	Locale         string
+	Data           MessageData
+	UnsubscribeURL string // Returned by the unsubscribeURL template helper
 }
 
 func (msgr *Messenger) ComposeMail(opts ComposeMailOpts) (*MailContents, error) {
@@ -39,31 +40,41 @@ func (msgr *Messenger) ComposeMail(opts ComposeMailOpts) (*MailContents, error)
 	htmlBody := ""
 	textBody := ""
 
-	htmlLayoutTmplFile := msgr.LayoutFile(MailChannel, RenderKindHTML)
-	htmlMsgTmplFiles := opts.Message.TemplateFiles(MailChannel, RenderKindHTML)
-	htmlTmplFiles := append([]string{htmlLayoutTmplFile}, htmlMsgTmplFiles...)
+	funcs := map[string]any{
+		"unsubscribeURL": func() string { return opts.UnsubscribeURL },
+	}
 
+	htmlTmpl, err := msgr.messageTemplate(
+		&opts.Message, MailChannel, RenderKindHTML,
+	)
+	if err != nil {
+		return nil, err
+	}
 	htmlBody, err = RenderHTML(RenderOpts{
-		Templates:     htmlTmplFiles,
+		Template:      htmlTmpl,
 		Data:          data,
 		Locale:        opts.Locale,
-		LayoutBundle:  msgr.layoutBundle,
+		LayoutBundle:  opts.Message.layoutBundle,
 		MessageBundle: opts.Message.localeBundle,
+		Funcs:         funcs,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	textLayoutTmplFile := msgr.LayoutFile(MailChannel, RenderKindText)
-	textMsgTmplFiles := opts.Message.TemplateFiles(MailChannel, RenderKindText)
-	textTmplFiles := append([]string{textLayoutTmplFile}, textMsgTmplFiles...)
-
+	textTmpl, err := msgr.messageTemplate(
+		&opts.Message, MailChannel, RenderKindText,
+	)
+	if err != nil {
+		return nil, err
+	}
 	textBody, err = RenderText(RenderOpts{
-		Templates:     textTmplFiles,
+		Template:      textTmpl,
 		Data:          data,
 		Locale:        opts.Locale,
-		LayoutBundle:  msgr.layoutBundle,
+		LayoutBundle:  opts.Message.layoutBundle,
 		MessageBundle: opts.Message.localeBundle,
+		Funcs:         funcs,
 	})
 	if err != nil {
 		return nil, err
@@ -91,16 +102,17 @@ func (msgr *Messenger) ComposeSMS(opts ComposeSMSOpts) (*SMSContents, error) {
 	maps.Copy(data, opts.Data)
 
 	// Body
-	layoutTmplFile := msgr.LayoutFile(SMSChannel, RenderKindText)
-	msgTmplFiles := opts.Message.TemplateFiles(MailChannel, RenderKindText)
-
-	tmplFiles := append([]string{layoutTmplFile}, msgTmplFiles...)
-
+	tmpl, err := msgr.messageTemplate(
+		&opts.Message, SMSChannel, RenderKindText,
+	)
+	if err != nil {
+		return nil, err
+	}
 	body, err := RenderText(RenderOpts{
-		Templates:     tmplFiles,
+		Template:      tmpl,
 		Data:          data,
 		Locale:        opts.Locale,
-		LayoutBundle:  msgr.layoutBundle,
+		LayoutBundle:  opts.Message.layoutBundle,
 		MessageBundle: opts.Message.localeBundle,
 	})
 	if err != nil {
@@ -140,16 +152,17 @@ func (msgr *Messenger) ComposePush(opts ComposePushOpts) (*PushContents, error)
 	}
 
 	// Body
-	layoutTmplFile := msgr.LayoutFile(PushChannel, RenderKindText)
-	msgTmplFiles := opts.Message.TemplateFiles(PushChannel, RenderKindText)
-
-	tmplFiles := append([]string{layoutTmplFile}, msgTmplFiles...)
-
+	tmpl, err := msgr.messageTemplate(
+		&opts.Message, PushChannel, RenderKindText,
+	)
+	if err != nil {
+		return nil, err
+	}
 	body, err := RenderText(RenderOpts{
-		Templates:     tmplFiles,
+		Template:      tmpl,
 		Data:          data,
 		Locale:        opts.Locale,
-		LayoutBundle:  msgr.layoutBundle,
+		LayoutBundle:  opts.Message.layoutBundle,
 		MessageBundle: opts.Message.localeBundle,
 	})
 	if err != nil {
@@ -0,0 +1,185 @@
+package msgr
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Time a result is kept for its idempotency key when no TTL is set
+const DefaultDedupeTTL = 24 * time.Hour
+
+// Puts between removals of the expired entries
+const dedupePruneEvery = 100
+
+// DedupeStore keeps the result of sends by idempotency key, so repeated sends
+// return the original result. Implementations must be safe for concurrent use.
+type DedupeStore interface {
+	// Get returns the result saved for key, or nil if none or it expired
+	Get(ctx context.Context, key string) (*SendResult, error)
+	Put(ctx context.Context, key string, res *SendResult, ttl time.Duration) error
+}
+
+type dedupeEntry struct {
+	Result  *SendResult `json:"result"`
+	Expires time.Time   `json:"expires"`
+}
+
+// MemoryDedupeStore is an in-memory DedupeStore with expiring entries
+type MemoryDedupeStore struct {
+	mu      sync.Mutex
+	entries map[string]dedupeEntry
+	puts    int // Puts since the last prune
+}
+
+func NewMemoryDedupeStore() *MemoryDedupeStore {
+	return &MemoryDedupeStore{entries: map[string]dedupeEntry{}}
+}
+
+func (s *MemoryDedupeStore) Get(
+	ctx context.Context, key string,
+) (*SendResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists || time.Now().After(entry.Expires) {
+		return nil, nil
+	}
+	return entry.Result, nil
+}
+
+func (s *MemoryDedupeStore) Put(
+	ctx context.Context, key string, res *SendResult, ttl time.Duration,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.puts++; s.puts >= dedupePruneEvery {
+		s.prune()
+	}
+	s.entries[key] = dedupeEntry{Result: res, Expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// prune removes expired entries, must be called with the lock held
+func (s *MemoryDedupeStore) prune() {
+	s.puts = 0
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.Expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// snapshot returns a copy of the entries
+func (s *MemoryDedupeStore) snapshot() map[string]dedupeEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.entries)
+}
+
+func (s *MemoryDedupeStore) clone() *MemoryDedupeStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &MemoryDedupeStore{entries: maps.Clone(s.entries), puts: s.puts}
+}
+
+// FileDedupeStore is a DedupeStore saved as a JSON file, rewritten on every
+// put, which suits low volumes of keyed sends. Errors in results are read
+// back with their message only.
+type FileDedupeStore struct {
+	file *jsonFile[MemoryDedupeStore, map[string]dedupeEntry]
+}
+
+// NewFileDedupeStore opens the store at path, creating it on first put
+func NewFileDedupeStore(path string) (*FileDedupeStore, error) {
+	entries, err := readJSONFile[map[string]dedupeEntry](path)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := NewMemoryDedupeStore()
+	if entries != nil {
+		mem.entries = entries
+	}
+
+	return &FileDedupeStore{file: newJSONFile(
+		path, mem, (*MemoryDedupeStore).clone, (*MemoryDedupeStore).snapshot,
+	)}, nil
+}
+
+func (s *FileDedupeStore) Get(
+	ctx context.Context, key string,
+) (*SendResult, error) {
+	return s.file.current().Get(ctx, key)
+}
+
+func (s *FileDedupeStore) Put(
+	ctx context.Context, key string, res *SendResult, ttl time.Duration,
+) error {
+	return s.file.update(func(mem *MemoryDedupeStore) error {
+		return mem.Put(ctx, key, res, ttl)
+	})
+}
+
+// dedupe returns the result saved for the idempotency key of opts, or sends
+// and saves the result. Concurrent sends with the same key wait for the first
+// one. Results are not saved when every channel failed, so the send can be
+// retried with the same key.
+func (msgr *Messenger) dedupe(
+	ctx context.Context, opts SendOpts,
+	send func() (*SendResult, error),
+) (*SendResult, error) {
+	key := opts.IdempotencyKey
+
+	// Wait for a send in flight with the same key
+	for {
+		msgr.inflightMu.Lock()
+		wait, exists := msgr.inflight[key]
+		if !exists {
+			msgr.inflight[key] = make(chan struct{})
+			msgr.inflightMu.Unlock()
+			break
+		}
+		msgr.inflightMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+		}
+	}
+
+	defer func() {
+		msgr.inflightMu.Lock()
+		close(msgr.inflight[key])
+		delete(msgr.inflight, key)
+		msgr.inflightMu.Unlock()
+	}()
+
+	saved, err := msgr.dedupeStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if saved != nil {
+		duplicate := *saved
+		duplicate.Duplicate = true
+		return &duplicate, duplicate.Err()
+	}
+
+	result, err := send()
+	if result == nil || result.allFailed() {
+		return result, err
+	}
+
+	if putErr := msgr.dedupeStore.Put(ctx, key, result, msgr.dedupeTTL); putErr != nil {
+		return result, putErr
+	}
+
+	return result, err
+}
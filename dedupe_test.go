@@ -0,0 +1,169 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+func TestFileDedupeStoreKeepsErrorMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe.json")
+	ctx := context.Background()
+
+	store, err := NewFileDedupeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &SendResult{MessageName: "welcome", Channels: []ChannelResult{{
+		Channel: PushChannel,
+		Status:  SendStatusFailed,
+		Error:   errors.New("push failed"),
+		Devices: []provider.PushResult{
+			{DeviceToken: "a", Error: errors.New("bad token")},
+			{DeviceToken: "b", MessageID: "push-id"},
+		},
+		ProviderAttempts: []ProviderAttempt{
+			{Provider: "apple", Attempts: 2, Error: errors.New("unavailable")},
+		},
+	}}}
+	if err := store.Put(ctx, "key", res, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileDedupeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, "key")
+	if err != nil || got == nil {
+		t.Fatalf("got %v, %v reading the saved result", got, err)
+	}
+
+	ch := got.Channel(PushChannel)
+	if ch == nil || provider.ErrorMessage(ch.Error) != "push failed" {
+		t.Fatalf("got channel result %+v", ch)
+	}
+	if len(ch.Devices) != 2 ||
+		provider.ErrorMessage(ch.Devices[0].Error) != "bad token" ||
+		ch.Devices[1].Error != nil || ch.Devices[1].MessageID != "push-id" {
+		t.Errorf("got devices %+v", ch.Devices)
+	}
+	if len(ch.ProviderAttempts) != 1 ||
+		provider.ErrorMessage(ch.ProviderAttempts[0].Error) != "unavailable" ||
+		ch.ProviderAttempts[0].Attempts != 2 {
+		t.Errorf("got provider attempts %+v", ch.ProviderAttempts)
+	}
+}
+
+func TestDedupeWaitsForSendInFlight(t *testing.T) {
+	var calls atomic.Int32
+	sending, release := make(chan struct{}), make(chan struct{})
+	mail := &testMail{send: func(
+		ctx context.Context, opts provider.MailSendOpts,
+	) error {
+		if calls.Add(1) == 1 {
+			close(sending)
+			<-release
+		}
+		return nil
+	}}
+	client := newTestClient(t, ClientOpts{}, mail)
+
+	opts := welcomeOpts("ada@example.com")
+	opts.IdempotencyKey = "welcome-ada"
+
+	type sent struct {
+		res *SendResult
+		err error
+	}
+	send := func(ctx context.Context) <-chan sent {
+		done := make(chan sent, 1)
+		go func() {
+			res, err := client.SendWithResult(ctx, opts)
+			done <- sent{res, err}
+		}()
+		return done
+	}
+
+	first := send(context.Background())
+	<-sending
+
+	// A waiting send gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if got := <-send(ctx); !errors.Is(got.err, context.DeadlineExceeded) {
+		t.Errorf("got %v waiting past the deadline", got.err)
+	}
+
+	second := send(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	firstSent, secondSent := <-first, <-second
+	if firstSent.err != nil || secondSent.err != nil {
+		t.Fatalf("got errors %v and %v", firstSent.err, secondSent.err)
+	}
+	if firstSent.res.Duplicate || !secondSent.res.Duplicate {
+		t.Errorf("got duplicate %v and %v, want false and true",
+			firstSent.res.Duplicate, secondSent.res.Duplicate)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d provider sends, want 1", n)
+	}
+}
+
+func TestDedupeRetriesFailedSend(t *testing.T) {
+	var calls atomic.Int32
+	mail := &testMail{send: func(
+		ctx context.Context, opts provider.MailSendOpts,
+	) error {
+		if calls.Add(1) == 1 {
+			return &provider.ProviderError{
+				Provider: "testmail", Permanent: true, Err: errors.New("down"),
+			}
+		}
+		return nil
+	}}
+	client := newTestClient(t, ClientOpts{}, mail)
+
+	opts := welcomeOpts("ada@example.com")
+	opts.IdempotencyKey = "welcome-ada"
+
+	if _, err := client.SendWithResult(context.Background(), opts); err == nil {
+		t.Fatal("expected the first send to fail")
+	}
+
+	res, err := client.SendWithResult(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Duplicate || calls.Load() != 2 {
+		t.Errorf("got duplicate %v after %d sends, want a new send",
+			res.Duplicate, calls.Load())
+	}
+}
+
+func TestMemoryDedupeStorePrunesEveryHundredPuts(t *testing.T) {
+	store := NewMemoryDedupeStore()
+	ctx := context.Background()
+
+	// Expired at once, kept until the next prune
+	_ = store.Put(ctx, "expired", &SendResult{}, -time.Second)
+	for i := 1; i < dedupePruneEvery-1; i++ {
+		_ = store.Put(ctx, "key", &SendResult{}, time.Hour)
+	}
+	if _, exists := store.entries["expired"]; !exists {
+		t.Fatal("got expired entry pruned before 100 puts")
+	}
+
+	_ = store.Put(ctx, "key", &SendResult{}, time.Hour)
+	if _, exists := store.entries["expired"]; exists || store.puts != 0 {
+		t.Errorf("got expired entry kept after 100 puts, %d puts", store.puts)
+	}
+}
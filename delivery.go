@@ -0,0 +1,115 @@
+package msgr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+type DeliveryMode string
+
+const (
+	// Send on every channel with a recipient, concurrently. This is the default.
+	DeliverAll DeliveryMode = "all"
+	// Send on one channel at a time in order, until one is sent. Channels
+	// failed, skipped or suppressed move on to the next.
+	DeliverFirstSuccess DeliveryMode = "first-success"
+	// Send on one channel at a time in order, moving on only when a channel
+	// failed. A skipped or suppressed channel ends the fallback.
+	DeliverFallback DeliveryMode = "fallback"
+)
+
+// Channel order used when DeliveryPolicy.Order is empty
+var defaultChannelOrder = []Channel{MailChannel, SMSChannel, PushChannel}
+
+// DeliveryPolicy sets which channels of a message are sent on. Channels
+// without a recipient are left out, so a fallback moves on to the next one.
+type DeliveryPolicy struct {
+	Mode DeliveryMode
+	// Channels in the order they are tried. Channels left out are not sent
+	// on, unless the order is empty.
+	Order []Channel
+}
+
+func (p DeliveryPolicy) equal(other DeliveryPolicy) bool {
+	return p.Mode == other.Mode && slices.Equal(p.Order, other.Order)
+}
+
+func (p DeliveryPolicy) validate() error {
+	switch p.Mode {
+	case "", DeliverAll, DeliverFirstSuccess, DeliverFallback:
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidPolicy, p.Mode)
+	}
+
+	for _, channel := range p.Order {
+		if !slices.Contains(defaultChannelOrder, channel) {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidPolicy, channel)
+		}
+	}
+
+	return nil
+}
+
+// sequential reports whether channels are sent one at a time
+func (p DeliveryPolicy) sequential() bool {
+	return p.Mode == DeliverFirstSuccess || p.Mode == DeliverFallback
+}
+
+// batchMail reports whether mail can be sent apart from the other channels,
+// through a batch endpoint
+func (p DeliveryPolicy) batchMail() bool {
+	if p.sequential() {
+		return false
+	}
+	return len(p.Order) == 0 || slices.Contains(p.Order, MailChannel)
+}
+
+// orderSends sorts the channel sends by the policy order, and drops those
+// not in it.
+func (p DeliveryPolicy) orderSends(sends []channelSend) []channelSend {
+	if len(p.Order) == 0 {
+		return sends
+	}
+
+	var ordered []channelSend
+	for _, channel := range p.Order {
+		for _, cs := range sends {
+			if cs.channel == channel {
+				ordered = append(ordered, cs)
+			}
+		}
+	}
+	return ordered
+}
+
+// next reports whether the channel after res is sent on
+func (p DeliveryPolicy) next(res ChannelResult) bool {
+	if p.Mode == DeliverFallback {
+		return res.Status == SendStatusFailed
+	}
+	return res.Status != SendStatusSent
+}
+
+// deliver sends on the channels of the message following its delivery policy
+func (msgr *Messenger) deliver(
+	ctx context.Context, msg *Message, opts SendOpts, sends []channelSend,
+) []ChannelResult {
+	policy := msg.deliveryPolicy
+	sends = policy.orderSends(sends)
+
+	if !policy.sequential() {
+		return msgr.runChannels(ctx, msg, opts, sends)
+	}
+
+	var results []ChannelResult
+	for _, cs := range sends {
+		res := msgr.runChannel(ctx, msg, opts, cs)
+		results = append(results, res)
+
+		if !policy.next(res) || ctx.Err() != nil {
+			break
+		}
+	}
+	return results
+}
@@ -0,0 +1,165 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// channelStatus is the outcome of a channel in a delivery test
+type channelStatus struct {
+	channel Channel
+	status  SendStatus
+}
+
+func TestDeliveryPolicy(t *testing.T) {
+	// Push, then SMS, then mail, as for one-time passwords
+	otpOrder := []Channel{PushChannel, SMSChannel, MailChannel}
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name   string
+		mode   DeliveryMode
+		noPush bool // Leave out the push recipient
+		// Outcome of the channels set by a hook, or by a suppression
+		outcomes   map[Channel]error
+		suppressed bool // Suppress the SMS recipient
+		want       []channelStatus
+		failed     bool // Want SendResult.Failed
+	}{{
+		name: "first success stops at the first channel sent",
+		mode: DeliverFirstSuccess,
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSent},
+		},
+	}, {
+		name:   "channel without recipient passed over",
+		mode:   DeliverFirstSuccess,
+		noPush: true,
+		want:   []channelStatus{{SMSChannel, SendStatusSent}},
+	}, {
+		name:     "failed channel moves on",
+		mode:     DeliverFallback,
+		outcomes: map[Channel]error{SMSChannel: failed},
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusFailed},
+			{MailChannel, SendStatusSent},
+		},
+	}, {
+		name:       "suppressed channel continues first success",
+		mode:       DeliverFirstSuccess,
+		suppressed: true,
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSuppressed},
+			{MailChannel, SendStatusSent},
+		},
+	}, {
+		name:       "suppressed channel ends fallback",
+		mode:       DeliverFallback,
+		suppressed: true,
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSuppressed},
+		},
+		failed: true,
+	}, {
+		name:     "skipped channel continues first success",
+		mode:     DeliverFirstSuccess,
+		outcomes: map[Channel]error{SMSChannel: ErrSkipChannel},
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSkipped},
+			{MailChannel, SendStatusSent},
+		},
+	}, {
+		name:     "skipped channel ends fallback",
+		mode:     DeliverFallback,
+		outcomes: map[Channel]error{SMSChannel: ErrSkipChannel},
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSkipped},
+		},
+		failed: true,
+	}, {
+		name: "every channel fails",
+		mode: DeliverFallback,
+		outcomes: map[Channel]error{
+			SMSChannel: failed, MailChannel: failed,
+		},
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusFailed},
+			{MailChannel, SendStatusFailed},
+		},
+		failed: true,
+	}, {
+		name: "all sends on every channel",
+		mode: DeliverAll,
+		want: []channelStatus{
+			{PushChannel, SendStatusFailed}, {SMSChannel, SendStatusSent},
+			{MailChannel, SendStatusSent},
+		},
+		failed: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressions := NewMemorySuppressionStore()
+			if tt.suppressed {
+				_ = suppressions.Add(context.Background(), Suppression{
+					Channel: SMSChannel, Address: "+15550100",
+					Reason: SuppressionManual,
+				})
+			}
+
+			// Push fails as Apple has no provider
+			client := newTestClient(t, ClientOpts{
+				SMSProvider:      &testSMS{},
+				PushProviders:    &provider.PushProviders{},
+				SuppressionStore: suppressions,
+				Messages: []AddMessageOpts{{
+					Name: "welcome",
+					DeliveryPolicy: DeliveryPolicy{
+						Mode: tt.mode, Order: otpOrder,
+					},
+				}},
+			}, &testMail{})
+			client.AddHooks(Hooks{
+				BeforeCompose: func(ctx context.Context, event *HookEvent) error {
+					return tt.outcomes[event.Channel]
+				},
+			})
+
+			opts := welcomeOpts("ada@example.com")
+			opts.SMSTo = "+15550100"
+			if !tt.noPush {
+				opts.PushTo = []provider.PushDevice{
+					{Token: "token", Platform: provider.PushPlatformApple},
+				}
+			}
+
+			result, _ := client.SendWithResult(context.Background(), opts)
+
+			var got []channelStatus
+			for _, res := range result.Channels {
+				got = append(got, channelStatus{res.Channel, res.Status})
+			}
+			if tt.mode == DeliverAll {
+				// Sent concurrently, results follow the policy order
+				slices.SortFunc(got, func(a, b channelStatus) int {
+					return slices.Index(otpOrder, a.channel) -
+						slices.Index(otpOrder, b.channel)
+				})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got channels %v, want %v", got, tt.want)
+			}
+
+			if result.Fallback != (tt.mode != DeliverAll) {
+				t.Errorf("got Fallback %v for mode %s", result.Fallback, tt.mode)
+			}
+			if result.Failed() != tt.failed {
+				t.Errorf("got Failed %v, want %v", result.Failed(), tt.failed)
+			}
+		})
+	}
+}
@@ -3,7 +3,23 @@ package msgr
 import "errors"
 
 var (
-	ErrInvalidMessage = errors.New("invalid message")
-	ErrNoProviders    = errors.New("no providers found")
-	ErrInvalidFormat  = errors.New(`invalid format, needs to be "html" or "text"`)
+	ErrInvalidMessage    = errors.New("invalid message")
+	ErrNoProviders       = errors.New("no providers found")
+	ErrInvalidFormat     = errors.New(`invalid format, needs to be "html" or "text"`)
+	ErrNoQueue           = errors.New("no queue configured")
+	ErrQueueClosed       = errors.New("queue closed")
+	ErrNoScheduler       = errors.New("no schedule store configured")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrRateLimited       = errors.New("rate limit exceeded")
+	ErrSkipChannel       = errors.New("channel skipped")
+	ErrNoResolver        = errors.New("no recipient resolver configured")
+	ErrRecipientNotFound = errors.New("recipient not found")
+	ErrInvalidPolicy     = errors.New("invalid delivery policy")
+	ErrInvalidAddress    = errors.New("invalid mail address")
+	ErrInvalidAttachment = errors.New("invalid attachment")
+	ErrInvalidHeader     = errors.New("invalid mail header")
+	ErrInvalidToken      = errors.New("invalid unsubscribe token")
+	ErrNoSuppression     = errors.New("no suppression store configured")
+	ErrTemplateNotFound  = errors.New("template not found")
+	ErrMessageExists     = errors.New("message registered with other options")
 )
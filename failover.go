@@ -0,0 +1,115 @@
+package msgr
+
+import (
+	"context"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// ProviderAttempt records the sends made with a provider of a channel
+type ProviderAttempt struct {
+	Provider string
+	Attempts int
+	Error    error
+}
+
+// MarshalJSON encodes the error as its message, so results can be saved
+func (a ProviderAttempt) MarshalJSON() ([]byte, error) {
+	type alias ProviderAttempt
+	return provider.MarshalWithError(alias(a))
+}
+
+func (a *ProviderAttempt) UnmarshalJSON(data []byte) error {
+	type alias ProviderAttempt
+	return provider.UnmarshalWithError(data, (*alias)(a))
+}
+
+type namedProvider interface {
+	Name() string
+}
+
+// failover sends with each provider in order, retrying each of them following
+// policy. It moves on to the next provider only when the error is retryable,
+// and records the provider which delivered in res.
+func failover[P namedProvider](
+	ctx context.Context, policy RetryPolicy, providers []P, res *ChannelResult,
+	send func(p P) (messageID string, err error),
+) error {
+	if len(providers) == 0 {
+		return ErrNoProviders
+	}
+
+	var err error
+	for _, p := range providers {
+		attempt := ProviderAttempt{Provider: p.Name()}
+
+		var messageID string
+		attempt.Attempts, attempt.Error = policy.do(ctx, func() error {
+			var sendErr error
+			messageID, sendErr = send(p)
+			return sendErr
+		})
+
+		res.Provider = attempt.Provider
+		res.Attempts += attempt.Attempts
+		res.ProviderAttempts = append(res.ProviderAttempts, attempt)
+
+		err = attempt.Error
+		if err == nil {
+			res.MessageID = messageID
+			return nil
+		}
+
+		if !provider.IsRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// deliverMail sends mail with failover between providers
+func (msgr *Messenger) deliverMail(
+	ctx context.Context, providers []provider.MailProvider,
+	opts provider.MailSendOpts, res *ChannelResult,
+) error {
+	policy := msgr.retryPolicy(MailChannel)
+	return failover(ctx, policy, providers, res,
+		func(p provider.MailProvider) (string, error) {
+			waited, err := msgr.takeProvider(ctx, p.Name(), 1)
+			res.RateLimitWait += waited
+			if err != nil {
+				return "", err
+			}
+
+			sent, err := p.Send(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			return sent.MessageID, nil
+		},
+	)
+}
+
+// deliverSMS sends SMS with failover between providers
+func (msgr *Messenger) deliverSMS(
+	ctx context.Context, providers []provider.SMSProvider,
+	opts provider.SMSProviderSendOpts, res *ChannelResult,
+) error {
+	policy := msgr.retryPolicy(SMSChannel)
+	return failover(ctx, policy, providers, res,
+		func(p provider.SMSProvider) (string, error) {
+			waited, err := msgr.takeProvider(ctx, p.Name(), 1)
+			res.RateLimitWait += waited
+			if err != nil {
+				return "", err
+			}
+
+			sent, err := p.Send(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			return sent.MessageID, nil
+		},
+	)
+}
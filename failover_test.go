@@ -0,0 +1,140 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// scriptedMail fails with its errors in turn, then sends. Calls are recorded
+// in a log shared between providers.
+type scriptedMail struct {
+	name string
+	errs []error
+	log  *callLog
+}
+
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *scriptedMail) Name() string { return p.name }
+
+func (p *scriptedMail) Send(
+	ctx context.Context, opts provider.MailSendOpts,
+) (*provider.MailSendResult, error) {
+	p.log.mu.Lock()
+	defer p.log.mu.Unlock()
+
+	p.log.calls = append(p.log.calls, p.name)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	return &provider.MailSendResult{MessageID: p.name + "-id"}, nil
+}
+
+func TestFailoverOrder(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	rejected := &provider.ProviderError{
+		Provider: "primary", Permanent: true, Err: errors.New("rejected"),
+	}
+
+	tests := []struct {
+		name      string
+		primary   []error
+		secondary []error
+		calls     []string
+		provider  string // Provider which delivered, or failed last
+		attempts  []int  // Attempts made with each provider
+		err       error
+	}{{
+		name:     "primary sends",
+		calls:    []string{"primary"},
+		provider: "primary",
+		attempts: []int{1},
+	}, {
+		name:     "primary retried",
+		primary:  []error{unavailable},
+		calls:    []string{"primary", "primary"},
+		provider: "primary",
+		attempts: []int{2},
+	}, {
+		name:     "failover after retries",
+		primary:  []error{unavailable, unavailable},
+		calls:    []string{"primary", "primary", "secondary"},
+		provider: "secondary",
+		attempts: []int{2, 1},
+	}, {
+		name:     "no failover on permanent error",
+		primary:  []error{rejected},
+		calls:    []string{"primary"},
+		provider: "primary",
+		attempts: []int{1},
+		err:      rejected,
+	}, {
+		name:      "every provider fails",
+		primary:   []error{unavailable, unavailable},
+		secondary: []error{unavailable, unavailable},
+		calls:     []string{"primary", "primary", "secondary", "secondary"},
+		provider:  "secondary",
+		attempts:  []int{2, 2},
+		err:       unavailable,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &callLog{}
+			client := newTestClient(t, ClientOpts{
+				MailProvider: &scriptedMail{
+					name: "primary", errs: tt.primary, log: log,
+				},
+				MailProviders: []provider.MailProvider{&scriptedMail{
+					name: "secondary", errs: tt.secondary, log: log,
+				}},
+				RetryPolicy: &RetryPolicy{
+					MaxAttempts: 2, InitialBackoff: time.Millisecond,
+				},
+			}, nil)
+
+			result, _ := client.SendWithResult(
+				context.Background(), welcomeOpts("ada@example.com"),
+			)
+			res := result.Channel(MailChannel)
+			if res == nil {
+				t.Fatal("got no mail result")
+			}
+
+			if !slices.Equal(log.calls, tt.calls) {
+				t.Errorf("got calls %v, want %v", log.calls, tt.calls)
+			}
+			if res.Provider != tt.provider {
+				t.Errorf("got provider %s, want %s", res.Provider, tt.provider)
+			}
+			if !errors.Is(res.Error, tt.err) {
+				t.Errorf("got error %v, want %v", res.Error, tt.err)
+			}
+			if tt.err == nil && res.MessageID != tt.provider+"-id" {
+				t.Errorf("got message ID %q", res.MessageID)
+			}
+
+			var attempts []int
+			total := 0
+			for _, attempt := range res.ProviderAttempts {
+				attempts = append(attempts, attempt.Attempts)
+				total += attempt.Attempts
+			}
+			if !slices.Equal(attempts, tt.attempts) || res.Attempts != total {
+				t.Errorf("got attempts %v, %d in total, want %v",
+					attempts, res.Attempts, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package msgr
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// jsonFile keeps a memory store M saved to a JSON file as its state S,
+// rewritten whole after every change. Changes are made to a copy of the
+// store, swapped in once the file is written, so a failed write leaves the
+// store as it was.
+type jsonFile[M, S any] struct {
+	path  string
+	mu    sync.Mutex // Serializes updates
+	mem   atomic.Pointer[M]
+	clone func(mem *M) *M
+	state func(mem *M) S
+}
+
+func newJSONFile[M, S any](
+	path string, mem *M, clone func(mem *M) *M, state func(mem *M) S,
+) *jsonFile[M, S] {
+	f := &jsonFile[M, S]{path: path, clone: clone, state: state}
+	f.mem.Store(mem)
+	return f
+}
+
+// current returns the memory store, as of the latest update written
+func (f *jsonFile[M, S]) current() *M {
+	return f.mem.Load()
+}
+
+// readJSONFile returns the state saved at path, or the zero S if there is no
+// file yet.
+func readJSONFile[S any](path string) (S, error) {
+	var state S
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// update applies change to a copy of the memory store, saves the copy and
+// swaps it in. Updates are serialized, so the file always holds the latest
+// state.
+func (f *jsonFile[M, S]) update(change func(mem *M) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	next := f.clone(f.mem.Load())
+	if err := change(next); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(f.state(next))
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(f.path, data); err != nil {
+		return err
+	}
+
+	f.mem.Store(next)
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, writing to a temporary
+// file first so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
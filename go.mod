@@ -11,6 +11,7 @@ require (
 	firebase.google.com/go/v4 v4.15.2
 	github.com/sideshow/apns2 v0.25.0
 	golang.org/x/text v0.23.0
+	golang.org/x/time v0.11.0
 	google.golang.org/api v0.226.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -57,7 +58,6 @@ require (
 	golang.org/x/oauth2 v0.28.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
-	golang.org/x/time v0.11.0 // indirect
 	google.golang.org/appengine/v2 v2.0.6 // indirect
 	google.golang.org/genproto v0.0.0-20241118233622-e639e219e697 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250106144421-5f5ef82da422 // indirect
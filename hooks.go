@@ -0,0 +1,117 @@
+package msgr
+
+import (
+	"context"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// SendFunc sends a message and returns the outcome, like SendWithResult
+type SendFunc func(ctx context.Context, opts SendOpts) (*SendResult, error)
+
+// Middleware wraps the sends of SendWithResult, including those of Send,
+// SendContext, queued, scheduled and batch sends. It can rewrite the opts,
+// inspect the result, or return without calling next.
+type Middleware func(next SendFunc) SendFunc
+
+// HookEvent is passed to the hooks of a channel send. Hooks can mutate the
+// opts, contents and provider options, which are a copy for the channel.
+// Values nested in Opts.Data are shared with the other channels.
+type HookEvent struct {
+	MessageName string
+	Channel     Channel
+	// Recipient, data and locale used to compose
+	Opts *SendOpts
+	// Set after composition, for the channel of the event
+	Mail *MailContents
+	SMS  *SMSContents
+	Push *PushContents
+	// Set before delivery, for the channel of the event
+	MailSendOpts *provider.MailSendOpts
+	SMSSendOpts  *provider.SMSProviderSendOpts
+	PushSendOpts *provider.PushProviderSendOpts
+	// Outcome of the channel, complete after delivery
+	Result *ChannelResult
+}
+
+// Hook is called at a step of a channel send. Returning ErrSkipChannel skips
+// the channel, and any other error fails it.
+type Hook func(ctx context.Context, event *HookEvent) error
+
+// Hooks called around composition and delivery of each channel, any of them
+// can be nil
+type Hooks struct {
+	BeforeCompose Hook
+	AfterCompose  Hook
+	BeforeDeliver Hook
+	AfterDeliver  func(ctx context.Context, event *HookEvent)
+}
+
+// Use adds middleware around sends, the first added is the outermost
+func (msgr *Messenger) Use(middleware ...Middleware) {
+	msgr.extensionsMu.Lock()
+	defer msgr.extensionsMu.Unlock()
+
+	msgr.middleware = append(msgr.middleware, middleware...)
+}
+
+// AddHooks adds hooks to every channel send, called in the order added
+func (msgr *Messenger) AddHooks(hooks Hooks) {
+	msgr.extensionsMu.Lock()
+	defer msgr.extensionsMu.Unlock()
+
+	msgr.hooks = append(msgr.hooks, hooks)
+}
+
+func (msgr *Messenger) hasMiddleware() bool {
+	msgr.extensionsMu.RLock()
+	defer msgr.extensionsMu.RUnlock()
+
+	return len(msgr.middleware) > 0
+}
+
+// sendFunc returns the send wrapped in the middleware
+func (msgr *Messenger) sendFunc(send SendFunc) SendFunc {
+	msgr.extensionsMu.RLock()
+	defer msgr.extensionsMu.RUnlock()
+
+	for i := len(msgr.middleware) - 1; i >= 0; i-- {
+		send = msgr.middleware[i](send)
+	}
+	return send
+}
+
+// runHooks calls the hook selected from each of the hooks added, and stops at
+// the first error.
+func (msgr *Messenger) runHooks(
+	ctx context.Context, event *HookEvent, hook func(hooks Hooks) Hook,
+) error {
+	msgr.extensionsMu.RLock()
+	hooksList := msgr.hooks
+	msgr.extensionsMu.RUnlock()
+
+	for _, hooks := range hooksList {
+		if h := hook(hooks); h != nil {
+			if err := h(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (msgr *Messenger) afterDeliver(ctx context.Context, event *HookEvent) {
+	msgr.extensionsMu.RLock()
+	hooksList := msgr.hooks
+	msgr.extensionsMu.RUnlock()
+
+	for _, hooks := range hooksList {
+		if hooks.AfterDeliver != nil {
+			hooks.AfterDeliver(ctx, event)
+		}
+	}
+}
+
+func beforeCompose(hooks Hooks) Hook { return hooks.BeforeCompose }
+func afterCompose(hooks Hooks) Hook  { return hooks.AfterCompose }
+func beforeDeliver(hooks Hooks) Hook { return hooks.BeforeDeliver }
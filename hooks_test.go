@@ -0,0 +1,70 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSendBatchRunsMiddleware(t *testing.T) {
+	mail := &testBatchMail{}
+	client := newTestClient(t, ClientOpts{MailProvider: mail}, nil)
+
+	blocked := errors.New("blocked")
+	client.Use(func(next SendFunc) SendFunc {
+		return func(ctx context.Context, opts SendOpts) (*SendResult, error) {
+			if opts.MailTo == "blocked@example.com" {
+				return nil, blocked
+			}
+			opts.MailTo = "rewritten@example.com"
+			return next(ctx, opts)
+		}
+	})
+
+	result, _ := client.SendBatch(context.Background(), SendBatchOpts{
+		MessageName: "welcome",
+		Recipients: []BatchRecipient{
+			{MailTo: "ada@example.com", Data: MessageData{"Name": "Ada"}},
+			{MailTo: "blocked@example.com", Data: MessageData{"Name": "Bob"}},
+		},
+	})
+
+	if mail.count() != 1 || mail.sent[0].To[0].Address != "rewritten@example.com" {
+		t.Fatalf("got mails %+v, want one to the rewritten address", mail.sent)
+	}
+
+	if status := result.Results[0].Channel(MailChannel).Status; status != SendStatusSent {
+		t.Errorf("got status %q for the first recipient, want sent", status)
+	}
+	blockedRes := result.Results[1].Channel(MailChannel)
+	if blockedRes == nil || !errors.Is(blockedRes.Error, blocked) {
+		t.Errorf("got %+v for the blocked recipient, want the middleware error", blockedRes)
+	}
+}
+
+func TestHooksMutateChannelCopyOfData(t *testing.T) {
+	mail, sms := &testMail{}, &testSMS{}
+	client := newTestClient(t, ClientOpts{SMSProvider: sms}, mail)
+
+	client.AddHooks(Hooks{
+		BeforeCompose: func(ctx context.Context, event *HookEvent) error {
+			event.Opts.Data["Name"] = "redacted"
+			event.Opts.Data[string(event.Channel)] = true
+			return nil
+		},
+	})
+
+	opts := welcomeOpts("ada@example.com")
+	opts.SMSTo = "+15550100"
+	if _, err := client.SendWithResult(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts.Data) != 1 || opts.Data["Name"] != "Ada" {
+		t.Errorf("got caller data %v, want it unchanged", opts.Data)
+	}
+	if mail.count() != 1 || sms.count() != 1 {
+		t.Errorf("got %d mails and %d SMS, want one of each",
+			mail.count(), sms.count())
+	}
+}
@@ -1,8 +1,9 @@
 package msgr
 
 import (
+	"context"
+	"fmt"
 	htmlTemplate "html/template"
-	"path/filepath"
 	textTemplate "text/template"
 
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -10,10 +11,13 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// createLocaleBundle loads the locales of a message, or of the layouts when
+// messageName is empty
 func createLocaleBundle(
-	path string, defaultLocale language.Tag,
+	ctx context.Context, source TemplateSource, messageName string,
+	defaultLocale language.Tag,
 ) (*i18n.Bundle, error) {
-	localeFiles, err := findLocaleFiles(path)
+	locales, err := source.Locales(ctx, messageName)
 	if err != nil {
 		return nil, err
 	}
@@ -21,8 +25,10 @@ func createLocaleBundle(
 	bundle := i18n.NewBundle(defaultLocale)
 	bundle.RegisterUnmarshalFunc("yml", yaml.Unmarshal)
 
-	for _, file := range localeFiles {
-		if _, err := bundle.LoadMessageFile(file); err != nil {
+	for locale, content := range locales {
+		// The locale and format are taken from the file name
+		file := fmt.Sprintf("locale.%s.yml", locale)
+		if _, err := bundle.ParseMessageFileBytes(content, file); err != nil {
 			return nil, err
 		}
 	}
@@ -30,17 +36,6 @@ func createLocaleBundle(
 	return bundle, nil
 }
 
-func findLocaleFiles(path string) ([]string, error) {
-	pattern := filepath.Join(path, "locale.*.yml")
-
-	files, err := filepath.Glob(pattern)
-	if err != nil {
-		return nil, err
-	}
-
-	return files, nil
-}
-
 func textTemplateHelpers(
 	layoutBundle *i18n.Bundle, messageBundle *i18n.Bundle, locale string,
 ) textTemplate.FuncMap {
@@ -59,6 +54,8 @@ func textTemplateHelpers(
 				TemplateData: data,
 			})
 		},
+		// Link of the mail recipient, see UnsubscribeOpts
+		"unsubscribeURL": func() string { return "" },
 	}
 	return funcs
 }
@@ -81,6 +78,12 @@ func htmlTemplateHelpers(
 				TemplateData: data,
 			})
 		},
+		// Link of the mail recipient, see UnsubscribeOpts
+		"unsubscribeURL": func() string { return "" },
+		// Reference to an inline attachment, for img src attributes
+		"cid": func(contentID string) string {
+			return "cid:" + contentID
+		},
 	}
 	return funcs
 }
@@ -1,8 +1,9 @@
 package msgr
 
 import (
+	"context"
 	"fmt"
-	"path/filepath"
+	"text/template"
 
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"golang.org/x/text/language"
@@ -10,28 +11,44 @@ import (
 
 type Message struct {
 	name            string
-	templatePath    string
 	mailChannelOpts MailChannelOpts
+	deliveryPolicy  DeliveryPolicy
+	category        string
+	urgent          bool
 	localeBundle    *i18n.Bundle
+	layoutBundle    *i18n.Bundle // Layout locales loaded with the message
+	// Compiled template sets, see Messenger.AddMessage
+	templates map[templateKey]*template.Template
 }
 
 type NewMessageOpts struct {
 	name            string
-	templatesPath   string
+	source          TemplateSource
 	mailChannelOpts MailChannelOpts
+	deliveryPolicy  DeliveryPolicy
+	category        string
+	urgent          bool
 	defaultLocale   language.Tag
 }
 
-func NewMessage(opts NewMessageOpts) (*Message, error) {
-	bundle, err := createLocaleBundle(opts.templatesPath, opts.defaultLocale)
+func NewMessage(ctx context.Context, opts NewMessageOpts) (*Message, error) {
+	if err := opts.deliveryPolicy.validate(); err != nil {
+		return nil, err
+	}
+
+	bundle, err := createLocaleBundle(
+		ctx, opts.source, opts.name, opts.defaultLocale,
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	msg := Message{
 		name:            opts.name,
-		templatePath:    opts.templatesPath,
 		mailChannelOpts: opts.mailChannelOpts,
+		deliveryPolicy:  opts.deliveryPolicy,
+		category:        opts.category,
+		urgent:          opts.urgent,
 		localeBundle:    bundle,
 	}
 
@@ -43,12 +60,29 @@ func (msg *Message) Localizer(locale string) *i18n.Localizer {
 	return localizer
 }
 
-func (msg *Message) TemplateFiles(channel Channel, format RenderFormat) []string {
-	// TODO implement partials
+// addOpts returns the options the message was added with
+func (msg *Message) addOpts() AddMessageOpts {
+	return AddMessageOpts{
+		Name:            msg.name,
+		MailChannelOpts: msg.mailChannelOpts,
+		DeliveryPolicy:  msg.deliveryPolicy,
+		Category:        msg.category,
+		Urgent:          msg.urgent,
+	}
+}
 
-	index := filepath.Join(
-		msg.templatePath, fmt.Sprintf("index_%s.%s.tmpl", channel, format),
-	)
+// checkAddOpts returns ErrMessageExists unless the message was added with the
+// same options
+func (msg *Message) checkAddOpts(opts AddMessageOpts) error {
+	if !msg.addOpts().equal(opts) {
+		return fmt.Errorf("%w: %s", ErrMessageExists, opts.Name)
+	}
+	return nil
+}
 
-	return []string{index}
+// template returns the compiled template set of the channel, or nil
+func (msg *Message) template(
+	channel Channel, format RenderFormat,
+) *template.Template {
+	return msg.templates[templateKey{channel, format}]
 }
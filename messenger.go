@@ -1,9 +1,15 @@
 package msgr
 
 import (
-	"errors"
+	"cmp"
+	"context"
 	"fmt"
-	"path/filepath"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/fyrolabs/fyro-msgr/provider"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -11,36 +17,136 @@ import (
 )
 
 type Messenger struct {
-	LayoutData    MessageData
-	messageMap    map[string]Message
-	templatesRoot string
-	mailProvider  provider.MailProvider
-	mailOpts      *MailChannelOpts
-	smsProvider   provider.SMSProvider
-	pushProviders *provider.PushProviders
-	defaultLocale language.Tag
-	layoutBundle  *i18n.Bundle
+	LayoutData           MessageData
+	messageMap           map[string]Message
+	templateSource       TemplateSource
+	mailProviders        []provider.MailProvider
+	mailOpts             *MailChannelOpts
+	smsProviders         []provider.SMSProvider
+	pushProviders        *provider.PushProviders
+	pushConcurrency      int
+	batchConcurrency     int
+	queue                Queue
+	retryPolicyDefault   *RetryPolicy
+	channelRetryPolicies map[Channel]RetryPolicy
+	scheduleStore        ScheduleStore
+	scheduleWake         chan struct{}
+	scheduleStop         chan struct{}
+	scheduleStopOnce     sync.Once
+	channelLimiters      map[Channel]*limiter
+	providerLimiters     map[string]*limiter
+	suppressionStore     SuppressionStore
+	unsubscribe          *UnsubscribeOpts
+	recipientResolver    RecipientResolver
+	quietHours           map[string]QuietHours
+	middleware           []Middleware
+	hooks                []Hooks
+	extensionsMu         sync.RWMutex
+	dedupeStore          DedupeStore
+	dedupeTTL            time.Duration
+	inflight             map[string]chan struct{}
+	inflightMu           sync.Mutex
+	defaultLocale        language.Tag
+	layoutBundle         *i18n.Bundle
+	// Guards messageMap and layoutBundle, changed by AddMessage,
+	// ReplaceMessage, RemoveMessage and ReloadTemplates
+	messagesMu sync.RWMutex
+	// Held while loading or removing messages, so reloads do not overwrite
+	// the changes
+	loadMu           sync.Mutex
+	templatesVersion string
+	reloadStop       chan struct{}
+	reloadStopOnce   sync.Once
+	// Queue workers and scheduler, stopped by Shutdown
+	background     sync.WaitGroup
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
 }
 
 type ClientOpts struct {
 	// Path to email layout, locales, and templates
 	TemplatesRoot string
+	// Templates and locales are read from TemplatesRoot within the FS when
+	// set, such as an embed.FS, or from the TemplatesRoot directory otherwise
+	TemplatesFS fs.FS
+	// Source of the templates and locales, such as a database, overriding
+	// TemplatesRoot and TemplatesFS. See NewMemoryTemplateSource.
+	TemplateSource TemplateSource
+	// Polls the TemplateSource for changes and reloads the templates and
+	// locales, for development. Disabled when zero.
+	TemplatesReloadInterval time.Duration
+	// Called when reloading the templates fails, the previous ones are kept
+	OnReloadError func(error)
 	// Set the mail provider and default opts
 	MailProvider provider.MailProvider
-	MailOpts     *MailChannelOpts
+	// Failover mail providers, tried in order after MailProvider when it fails
+	// with a retryable error
+	MailProviders []provider.MailProvider
+	MailOpts      *MailChannelOpts
 	// SMS options
 	SMSProvider provider.SMSProvider
+	// Failover SMS providers, tried in order after SMSProvider
+	SMSProviders []provider.SMSProvider
 	// Push options
 	PushProviders *provider.PushProviders
+	// Max devices pushed to concurrently, see provider.DefaultPushConcurrency
+	PushConcurrency int
+	// Max recipients composed and sent concurrently by SendBatch, see
+	// DefaultBatchConcurrency
+	BatchConcurrency int
+	// Retry policy of every channel, retries are disabled when nil
+	RetryPolicy *RetryPolicy
+	// Retry policies by channel, overriding RetryPolicy
+	ChannelRetryPolicies map[Channel]RetryPolicy
+	// Rate limits by channel, push counts a send for each device
+	ChannelRateLimits map[Channel]RateLimit
+	// Rate limits by provider name, such as "postmark" or "apple"
+	ProviderRateLimits map[string]RateLimit
+	// Queue used by Enqueue, see NewMemoryQueue and NewFileQueue. Workers are
+	// started when set.
+	Queue Queue
+	// Number of workers sending from the queue, see DefaultQueueWorkers
+	QueueWorkers int
+	// Store of the sends scheduled with SendOpts.SendAt, see
+	// NewFileScheduleStore. The scheduler is started when set.
+	ScheduleStore ScheduleStore
+	// Quiet hours by message category, which defer sends through the
+	// scheduler so ScheduleStore must be set
+	QuietHours map[string]QuietHours
+	// Looks up contact info for SendToUser
+	RecipientResolver RecipientResolver
+	// Suppressed recipients, consulted before delivering on each channel
+	SuppressionStore SuppressionStore
+	// Enables unsubscribe links, recorded in the SuppressionStore
+	Unsubscribe *UnsubscribeOpts
+	// Store of results by SendOpts.IdempotencyKey, in memory when nil
+	DedupeStore DedupeStore
+	// Time results are kept for their idempotency key, see DefaultDedupeTTL
+	DedupeTTL     time.Duration
 	DefaultLocale string
 	// Fixed data to be used in the layout
 	LayoutData MessageData
+	// Messages registered before the queue workers start, so jobs left in a
+	// durable queue can be sent on startup
+	Messages []AddMessageOpts
 }
 
 type MessageData map[string]any
 
 func NewClient(opts ClientOpts) (*Messenger, error) {
-	if opts.MailProvider == nil && opts.SMSProvider == nil {
+	var mailProviders []provider.MailProvider
+	if opts.MailProvider != nil {
+		mailProviders = append(mailProviders, opts.MailProvider)
+	}
+	mailProviders = append(mailProviders, opts.MailProviders...)
+
+	var smsProviders []provider.SMSProvider
+	if opts.SMSProvider != nil {
+		smsProviders = append(smsProviders, opts.SMSProvider)
+	}
+	smsProviders = append(smsProviders, opts.SMSProviders...)
+
+	if len(mailProviders) == 0 && len(smsProviders) == 0 {
 		return nil, ErrNoProviders
 	}
 
@@ -49,7 +155,20 @@ func NewClient(opts ClientOpts) (*Messenger, error) {
 		return nil, err
 	}
 
-	bundle, err := createLocaleBundle(opts.TemplatesRoot, lang)
+	source := opts.TemplateSource
+	if source == nil {
+		// Paths are slash separated within the templates FS
+		templatesFS, templatesRoot := opts.TemplatesFS, opts.TemplatesRoot
+		if templatesFS == nil {
+			templatesFS = os.DirFS(cmp.Or(templatesRoot, "."))
+			templatesRoot = "."
+		}
+		source = NewFSTemplateSource(templatesFS, templatesRoot)
+	}
+
+	bundle, err := createLocaleBundle(
+		context.Background(), source, "", lang,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -59,166 +178,219 @@ func NewClient(opts ClientOpts) (*Messenger, error) {
 		layoutData = opts.LayoutData
 	}
 
-	return &Messenger{
-		messageMap:    map[string]Message{},
-		templatesRoot: opts.TemplatesRoot,
-		mailProvider:  opts.MailProvider,
-		mailOpts:      opts.MailOpts,
-		smsProvider:   opts.SMSProvider,
-		pushProviders: opts.PushProviders,
-		defaultLocale: lang, // Default locale
-		LayoutData:    layoutData,
-		layoutBundle:  bundle,
-	}, nil
-}
-
-type AddMessageOpts struct {
-	Name            string          // Must be unique
-	MailChannelOpts MailChannelOpts // Email channel options
-}
+	if len(opts.QuietHours) > 0 && opts.ScheduleStore == nil {
+		return nil, ErrNoScheduler
+	}
+	for category, quiet := range opts.QuietHours {
+		if err := quiet.validate(); err != nil {
+			return nil, fmt.Errorf("quiet hours %q: %w", category, err)
+		}
+	}
 
-func (msgr *Messenger) AddMessage(opts AddMessageOpts) error {
-	msg, err := NewMessage(NewMessageOpts{
-		name:            opts.Name,
-		templatesPath:   filepath.Join(msgr.templatesRoot, opts.Name),
-		mailChannelOpts: opts.MailChannelOpts,
-		defaultLocale:   msgr.defaultLocale,
-	})
-	if err != nil {
-		return err
+	if opts.Unsubscribe != nil {
+		if opts.SuppressionStore == nil {
+			return nil, ErrNoSuppression
+		}
+		if err := opts.Unsubscribe.validate(); err != nil {
+			return nil, err
+		}
 	}
 
-	msgr.messageMap[opts.Name] = *msg
-	return nil
-}
+	dedupeStore := opts.DedupeStore
+	if dedupeStore == nil {
+		dedupeStore = NewMemoryDedupeStore()
+	}
 
-func (msgr *Messenger) GetMessage(name string) (*Message, error) {
-	msg, exists := msgr.messageMap[name]
-	if !exists {
-		return nil, ErrInvalidMessage
+	dedupeTTL := opts.DedupeTTL
+	if dedupeTTL <= 0 {
+		dedupeTTL = DefaultDedupeTTL
 	}
 
-	return &msg, nil
-}
+	msgr := &Messenger{
+		messageMap:           map[string]Message{},
+		reloadStop:           make(chan struct{}),
+		templateSource:       source,
+		mailProviders:        mailProviders,
+		mailOpts:             opts.MailOpts,
+		smsProviders:         smsProviders,
+		pushProviders:        opts.PushProviders,
+		pushConcurrency:      opts.PushConcurrency,
+		batchConcurrency:     opts.BatchConcurrency,
+		queue:                opts.Queue,
+		scheduleStore:        opts.ScheduleStore,
+		scheduleWake:         make(chan struct{}, 1),
+		scheduleStop:         make(chan struct{}),
+		channelLimiters:      newLimiters(opts.ChannelRateLimits),
+		providerLimiters:     newLimiters(opts.ProviderRateLimits),
+		suppressionStore:     opts.SuppressionStore,
+		unsubscribe:          opts.Unsubscribe,
+		recipientResolver:    opts.RecipientResolver,
+		quietHours:           opts.QuietHours,
+		dedupeStore:          dedupeStore,
+		dedupeTTL:            dedupeTTL,
+		inflight:             map[string]chan struct{}{},
+		retryPolicyDefault:   opts.RetryPolicy,
+		channelRetryPolicies: opts.ChannelRetryPolicies,
+		defaultLocale:        lang, // Default locale
+		LayoutData:           layoutData,
+		layoutBundle:         bundle,
+	}
 
-type SendOpts struct {
-	MessageName string
-	MailTo      string                // If MailTo is defined, it will send email
-	SMSTo       string                // If SMSTo is defined, it will send SMS
-	PushTo      []provider.PushDevice // If pushTo has devices, it will send via push
-	Data        MessageData
-	Locale      string
-}
+	for _, msgOpts := range opts.Messages {
+		if err := msgr.AddMessage(msgOpts); err != nil {
+			return nil, err
+		}
+	}
 
-func (msgr *Messenger) Send(opts SendOpts) error {
-	msg, err := msgr.GetMessage(opts.MessageName)
-	if err != nil {
-		return err
+	// Changes made while the messages loaded are picked up by the first poll
+	if opts.TemplatesReloadInterval > 0 {
+		msgr.templatesVersion, err = source.Version(context.Background())
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	locale := opts.Locale
-	if opts.Locale == "" {
-		locale = msgr.defaultLocale.String()
+	msgr.backgroundCtx, msgr.stopBackground = context.WithCancel(
+		context.Background(),
+	)
+
+	if msgr.queue != nil {
+		msgr.startWorkers(opts.QueueWorkers)
 	}
 
-	// errors list for each send channel
-	var errs []error
+	if msgr.scheduleStore != nil {
+		msgr.startScheduler()
+	}
 
-	sendMail := func() error {
-		from := msgr.mailOpts.From
-		if msg.mailChannelOpts.From != "" {
-			from = msg.mailChannelOpts.From
-		}
+	if opts.TemplatesReloadInterval > 0 {
+		msgr.startReloader(opts.TemplatesReloadInterval, opts.OnReloadError)
+	}
 
-		// Use default replyTo, unless message has its own
-		replyTo := msgr.mailOpts.ReplyTo
-		if msg.mailChannelOpts.ReplyTo != "" {
-			replyTo = msg.mailChannelOpts.ReplyTo
-		}
+	return msgr, nil
+}
 
-		contents, err := msgr.ComposeMail(ComposeMailOpts{
-			Message: *msg,
-			Locale:  opts.Locale,
-			Data:    opts.Data,
-		})
-		if err != nil {
-			return err
-		}
+type AddMessageOpts struct {
+	Name            string          // Must be unique
+	MailChannelOpts MailChannelOpts // Email channel options
+	DeliveryPolicy  DeliveryPolicy  // Channels sent on, all by default
+	Category        string          // Selects the ClientOpts.QuietHours
+	Urgent          bool            // Sent during quiet hours, such as OTPs
+}
 
-		providerOpts := provider.MailSendOpts{
-			To:       opts.MailTo,
-			From:     from,
-			ReplyTo:  replyTo,
-			Subject:  contents.Subject,
-			HTMLBody: contents.HTMLBody,
-		}
+func (o AddMessageOpts) equal(other AddMessageOpts) bool {
+	return o.Name == other.Name && o.Category == other.Category &&
+		o.Urgent == other.Urgent &&
+		o.MailChannelOpts.equal(other.MailChannelOpts) &&
+		o.DeliveryPolicy.equal(other.DeliveryPolicy)
+}
 
-		return msgr.mailProvider.Send(providerOpts)
+// AddMessage registers a message. Adding a registered name again does nothing
+// when the options are the same, so it can be called lazily before sending,
+// and returns ErrMessageExists when they differ, see ReplaceMessage to update
+// a message. It is safe to call concurrently with sends.
+func (msgr *Messenger) AddMessage(opts AddMessageOpts) error {
+	if msg, err := msgr.GetMessage(opts.Name); err == nil {
+		return msg.checkAddOpts(opts)
 	}
+	return msgr.putMessage(opts, false)
+}
 
-	sendSMS := func() error {
-		contents, err := msgr.ComposeSMS(ComposeSMSOpts{
-			Message: *msg,
-			Locale:  locale,
-			Data:    opts.Data,
-		})
-		if err != nil {
-			return err
-		}
+// ReplaceMessage loads a registered message again with new options. Sends in
+// progress finish with the previous one.
+func (msgr *Messenger) ReplaceMessage(opts AddMessageOpts) error {
+	return msgr.putMessage(opts, true)
+}
 
-		providerOpts := provider.SMSProviderSendOpts{
-			To:   opts.SMSTo,
-			Body: contents.Body,
-		}
+// RemoveMessage unregisters a message. Queued and scheduled sends of the
+// message fail with ErrInvalidMessage once it is removed.
+func (msgr *Messenger) RemoveMessage(name string) error {
+	msgr.loadMu.Lock()
+	defer msgr.loadMu.Unlock()
+
+	msgr.messagesMu.Lock()
+	defer msgr.messagesMu.Unlock()
 
-		return msgr.smsProvider.Send(providerOpts)
+	if _, exists := msgr.messageMap[name]; !exists {
+		return ErrInvalidMessage
 	}
 
-	sendPush := func() error {
-		contents, err := msgr.ComposePush(ComposePushOpts{
-			Message: *msg,
-			Locale:  locale,
-			Data:    opts.Data,
-		})
-		if err != nil {
-			return err
-		}
+	delete(msgr.messageMap, name)
+	return nil
+}
+
+// ListMessages returns the names of the registered messages, sorted
+func (msgr *Messenger) ListMessages() []string {
+	msgr.messagesMu.RLock()
+	defer msgr.messagesMu.RUnlock()
 
-		return msgr.pushProviders.Send(provider.PushProviderSendOpts{
-			Devices: opts.PushTo,
-			Title:   contents.Title,
-			Body:    contents.Body,
-		})
+	return slices.Sorted(maps.Keys(msgr.messageMap))
+}
+
+// putMessage loads and registers a message, replacing the registered one only
+// when replace is set
+func (msgr *Messenger) putMessage(opts AddMessageOpts, replace bool) error {
+	msgr.loadMu.Lock()
+	defer msgr.loadMu.Unlock()
+
+	msgr.messagesMu.RLock()
+	registered, exists := msgr.messageMap[opts.Name]
+	layoutBundle := msgr.layoutBundle
+	msgr.messagesMu.RUnlock()
+
+	// Added meanwhile
+	if exists && !replace {
+		return registered.checkAddOpts(opts)
+	}
+	if !exists && replace {
+		return ErrInvalidMessage
 	}
 
-	// Send via email
-	if opts.MailTo != "" {
-		if err := sendMail(); err != nil {
-			errs = append(errs, err)
-		}
+	msg, err := msgr.loadMessage(context.Background(), opts, layoutBundle)
+	if err != nil {
+		return err
 	}
 
-	// Send via SMS
-	if opts.SMSTo != "" {
-		if err := sendSMS(); err != nil {
-			errs = append(errs, err)
-		}
+	msgr.messagesMu.Lock()
+	msgr.messageMap[opts.Name] = *msg
+	msgr.messagesMu.Unlock()
+	return nil
+}
+
+// loadMessage reads the locales and compiles the templates of a message
+func (msgr *Messenger) loadMessage(
+	ctx context.Context, opts AddMessageOpts, layoutBundle *i18n.Bundle,
+) (*Message, error) {
+	msg, err := NewMessage(ctx, NewMessageOpts{
+		name:            opts.Name,
+		source:          msgr.templateSource,
+		mailChannelOpts: opts.MailChannelOpts,
+		deliveryPolicy:  opts.DeliveryPolicy,
+		category:        opts.Category,
+		urgent:          opts.Urgent,
+		defaultLocale:   msgr.defaultLocale,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Send via push
-	if opts.PushTo != nil && msgr.pushProviders != nil {
-		if err := sendPush(); err != nil {
-			errs = append(errs, err)
-		}
+	// Templates are parsed once, and cloned for each render
+	msg.templates, err = msgr.compileTemplates(ctx, msg)
+	if err != nil {
+		return nil, err
 	}
 
-	return errors.Join(errs...)
+	msg.layoutBundle = layoutBundle
+	return msg, nil
 }
 
-func (msgr *Messenger) LayoutFile(channel Channel, format RenderFormat) string {
-	layout := filepath.Join(
-		msgr.templatesRoot,
-		fmt.Sprintf("layout_%s.%s.tmpl", channel, format),
-	)
-	return layout
+func (msgr *Messenger) GetMessage(name string) (*Message, error) {
+	msgr.messagesMu.RLock()
+	msg, exists := msgr.messageMap[name]
+	msgr.messagesMu.RUnlock()
+
+	if !exists {
+		return nil, ErrInvalidMessage
+	}
+
+	return &msg, nil
 }
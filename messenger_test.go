@@ -0,0 +1,210 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// testMail records the mails sent, after calling send when set
+type testMail struct {
+	mu   sync.Mutex
+	sent []provider.MailSendOpts
+	send func(ctx context.Context, opts provider.MailSendOpts) error
+}
+
+func (p *testMail) Name() string { return "testmail" }
+
+func (p *testMail) Send(
+	ctx context.Context, opts provider.MailSendOpts,
+) (*provider.MailSendResult, error) {
+	if p.send != nil {
+		if err := p.send(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent = append(p.sent, opts)
+	return &provider.MailSendResult{MessageID: "mail-id"}, nil
+}
+
+func (p *testMail) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.sent)
+}
+
+// testSMS records the SMS sent
+type testSMS struct {
+	mu   sync.Mutex
+	sent []provider.SMSProviderSendOpts
+}
+
+func (p *testSMS) Name() string { return "testsms" }
+
+func (p *testSMS) Send(
+	ctx context.Context, opts provider.SMSProviderSendOpts,
+) (*provider.SMSSendResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent = append(p.sent, opts)
+	return &provider.SMSSendResult{MessageID: "sms-id"}, nil
+}
+
+func (p *testSMS) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.sent)
+}
+
+// testTemplates returns a source with the "welcome" message, rendered on the
+// mail, SMS and push channels
+func testTemplates() *MemoryTemplateSource {
+	source := NewMemoryTemplateSource()
+
+	layouts := map[TemplateRef]string{
+		{Channel: MailChannel, Format: RenderKindHTML}: `<html><body>` +
+			`{{ template "content" . }}</body></html>`,
+		{Channel: MailChannel, Format: RenderKindText}: `{{ template "content" . }}`,
+		{Channel: SMSChannel, Format: RenderKindText}:  `{{ template "content" . }}`,
+		{Channel: PushChannel, Format: RenderKindText}: `{{ template "content" . }}`,
+		{MessageName: "welcome", Channel: PushChannel, Format: RenderKindText}: `` +
+			`{{ define "content" }}{{ t "greeting" . }}{{ end }}`,
+	}
+	for ref, content := range layouts {
+		source.SetTemplate(ref, content)
+	}
+
+	for _, format := range []RenderFormat{RenderKindHTML, RenderKindText} {
+		source.SetTemplate(TemplateRef{
+			MessageName: "welcome", Channel: MailChannel, Format: format,
+		}, `{{ define "content" }}{{ t "greeting" . }}{{ end }}`)
+	}
+
+	source.SetLocale("welcome", "en", []byte(
+		"mail_subject: Hello {{ .Name }}\ngreeting: Welcome {{ .Name }}\n",
+	))
+
+	return source
+}
+
+// newTestClient returns a client with the "welcome" message, sending mail
+// through mail unless opts sets the providers
+func newTestClient(t *testing.T, opts ClientOpts, mail *testMail) *Messenger {
+	t.Helper()
+
+	if opts.MailProvider == nil && mail != nil {
+		opts.MailProvider = mail
+	}
+	if opts.MailOpts == nil {
+		opts.MailOpts = &MailChannelOpts{From: "sender@example.com"}
+	}
+	if opts.TemplateSource == nil {
+		opts.TemplateSource = testTemplates()
+	}
+	if opts.DefaultLocale == "" {
+		opts.DefaultLocale = "en"
+	}
+	if opts.Messages == nil {
+		opts.Messages = []AddMessageOpts{{Name: "welcome"}}
+	}
+
+	client, err := NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = client.Shutdown(context.Background())
+	})
+
+	return client
+}
+
+func welcomeOpts(mailTo string) SendOpts {
+	return SendOpts{
+		MessageName: "welcome",
+		MailTo:      mailTo,
+		Data:        MessageData{"Name": "Ada"},
+	}
+}
+
+func TestMessageRegistry(t *testing.T) {
+	client := newTestClient(t, ClientOpts{}, &testMail{})
+
+	if err := client.AddMessage(AddMessageOpts{Name: "welcome"}); err != nil {
+		t.Fatalf("adding a registered message again: %v", err)
+	}
+	if err := client.AddMessage(AddMessageOpts{
+		Name: "welcome", Category: "news",
+	}); !errors.Is(err, ErrMessageExists) {
+		t.Errorf("got %v adding other options, want ErrMessageExists", err)
+	}
+	if msg, _ := client.GetMessage("welcome"); msg.category != "" {
+		t.Errorf("AddMessage replaced the registered message")
+	}
+
+	if err := client.ReplaceMessage(AddMessageOpts{
+		Name: "welcome", Category: "news",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := client.GetMessage("welcome"); msg.category != "news" {
+		t.Errorf("got category %q after replacing, want news", msg.category)
+	}
+
+	if err := client.ReplaceMessage(AddMessageOpts{Name: "missing"}); !errors.Is(
+		err, ErrInvalidMessage,
+	) {
+		t.Errorf("got %v replacing a missing message", err)
+	}
+
+	if err := client.RemoveMessage("welcome"); err != nil {
+		t.Fatal(err)
+	}
+	if names := client.ListMessages(); len(names) != 0 {
+		t.Errorf("got messages %v after removing, want none", names)
+	}
+	if _, err := client.SendWithResult(
+		context.Background(), welcomeOpts("ada@example.com"),
+	); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("got %v sending a removed message", err)
+	}
+}
+
+func TestMessageRegistryConcurrentUse(t *testing.T) {
+	client := newTestClient(t, ClientOpts{}, &testMail{})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for worker := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				switch worker {
+				case 0:
+					_ = client.AddMessage(AddMessageOpts{Name: "welcome"})
+				case 1:
+					_, _ = client.SendWithResult(ctx, welcomeOpts("ada@example.com"))
+				case 2:
+					_ = client.RemoveMessage("welcome")
+					_ = client.ListMessages()
+				case 3:
+					_ = client.ReplaceMessage(AddMessageOpts{Name: "welcome"})
+					_ = client.ReloadTemplates(ctx)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,329 @@
+package msgr
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Number of jobs finished, done or discarded, after which the journal of an
+// open FileQueue is compacted
+const outboxCompactAfter = 1000
+
+type outboxOp string
+
+const (
+	outboxPush    outboxOp = "push"
+	outboxAttempt outboxOp = "attempt"
+	outboxDone    outboxOp = "done"
+	outboxFailed  outboxOp = "failed"
+)
+
+// outboxEntry is a line of the outbox journal
+type outboxEntry struct {
+	Op       outboxOp  `json:"op"`
+	ID       string    `json:"id"`
+	Job      *Job      `json:"job,omitempty"`
+	Attempts int       `json:"attempts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// FailedJob is a job of a FileQueue whose send failed after its retries. It
+// is kept until it is retried or discarded.
+type FailedJob struct {
+	Job      *Job
+	Error    string
+	FailedAt time.Time
+}
+
+// outboxJob is a job not done yet, with the journal lines written for it
+type outboxJob struct {
+	seq      int // Order of the push
+	job      *Job
+	attempts int
+	failure  *FailedJob // Set once the send failed
+	// Latest journal lines of the job, written again on compaction
+	push, attempt, failed []byte
+}
+
+// FileQueue is a durable Queue backed by an append-only journal on disk. Each
+// push, attempt and outcome is written to the journal before it is applied, so
+// jobs pushed and not done are popped again after a restart. Jobs whose send
+// failed are kept, see Failed.
+type FileQueue struct {
+	path string
+	mem  *MemoryQueue
+
+	mu           sync.Mutex // Guards the journal and the fields below
+	jobs         map[string]*outboxJob
+	seq          int
+	finished     int // Jobs finished since the last compaction
+	compactAfter int
+}
+
+// NewFileQueue opens the journal at path, creating it if needed, and loads the
+// pending jobs. The journal is compacted to the jobs not done on open, and
+// again after every outboxCompactAfter jobs finished.
+func NewFileQueue(path string) (*FileQueue, error) {
+	q := &FileQueue{
+		path:         path,
+		mem:          NewMemoryQueue(),
+		jobs:         map[string]*outboxJob{},
+		compactAfter: outboxCompactAfter,
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	for _, oj := range q.sorted() {
+		oj.job.Attempts = oj.attempts
+		if oj.failure != nil {
+			continue
+		}
+		if err := q.mem.Push(context.Background(), oj.job); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+func (q *FileQueue) Push(ctx context.Context, job *Job) error {
+	if err := q.record(outboxEntry{
+		Op: outboxPush, ID: job.ID, Job: job,
+	}); err != nil {
+		return err
+	}
+	return q.mem.Push(ctx, job)
+}
+
+func (q *FileQueue) Pop(ctx context.Context) (*Job, error) {
+	job, err := q.mem.Pop(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.record(outboxEntry{
+		Op: outboxAttempt, ID: job.ID, Attempts: job.Attempts,
+	}); err != nil {
+		// Put the job back rather than losing it until the next restart
+		job.Attempts--
+		pushErr := q.mem.Push(context.WithoutCancel(ctx), job)
+		return nil, errors.Join(err, pushErr)
+	}
+
+	return job, nil
+}
+
+// Done records the outcome of a job. Failed jobs are kept in the journal with
+// their error, and are not popped again unless retried, see Failed.
+func (q *FileQueue) Done(ctx context.Context, job *Job, sendErr error) error {
+	entry := outboxEntry{Op: outboxDone, ID: job.ID, Attempts: job.Attempts}
+	if sendErr != nil {
+		entry.Op = outboxFailed
+		entry.Error = sendErr.Error()
+	}
+	return q.record(entry)
+}
+
+func (q *FileQueue) Close() error {
+	return q.mem.Close()
+}
+
+// Failed returns the jobs whose send failed, in the order they were pushed
+func (q *FileQueue) Failed() []FailedJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var failed []FailedJob
+	for _, oj := range q.sorted() {
+		if oj.failure != nil {
+			failed = append(failed, *oj.failure)
+		}
+	}
+	return failed
+}
+
+// Retry pushes a failed job back to the queue. It returns ErrJobNotFound if
+// no failed job has the ID.
+func (q *FileQueue) Retry(ctx context.Context, id string) error {
+	q.mu.Lock()
+	oj, exists := q.jobs[id]
+	if !exists || oj.failure == nil {
+		q.mu.Unlock()
+		return ErrJobNotFound
+	}
+
+	job := *oj.job
+	err := q.write(outboxEntry{Op: outboxPush, ID: id, Job: &job})
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return q.mem.Push(ctx, &job)
+}
+
+// Discard removes a failed job from the journal. It returns ErrJobNotFound if
+// no failed job has the ID.
+func (q *FileQueue) Discard(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	oj, exists := q.jobs[id]
+	if !exists || oj.failure == nil {
+		return ErrJobNotFound
+	}
+
+	return q.write(outboxEntry{Op: outboxDone, ID: id})
+}
+
+// record writes an entry to the journal and applies it
+func (q *FileQueue) record(entry outboxEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.write(entry)
+}
+
+// write appends an entry to the journal, syncs it to disk and applies it. The
+// journal is compacted once enough jobs finished. Must be called with the
+// lock held.
+func (q *FileQueue) write(entry outboxEntry) error {
+	entry.Time = time.Now()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	q.apply(entry, line)
+
+	if q.finished >= q.compactAfter {
+		// The entry is saved, a failed compaction is tried again on the
+		// next finished job
+		_ = q.compact()
+	}
+
+	return nil
+}
+
+// apply updates the jobs with an entry of the journal, written as line
+func (q *FileQueue) apply(entry outboxEntry, line []byte) {
+	oj, exists := q.jobs[entry.ID]
+
+	switch entry.Op {
+	case outboxPush:
+		if entry.Job != nil {
+			q.seq++
+			q.jobs[entry.ID] = &outboxJob{
+				seq: q.seq, job: entry.Job, attempts: entry.Job.Attempts,
+				push: line,
+			}
+		}
+	case outboxAttempt:
+		if exists {
+			oj.attempts, oj.attempt = entry.Attempts, line
+		}
+	case outboxFailed:
+		if exists {
+			oj.failure = &FailedJob{
+				Job: oj.job, Error: entry.Error, FailedAt: entry.Time,
+			}
+			oj.failed = line
+			q.finished++
+		}
+	case outboxDone:
+		if exists {
+			delete(q.jobs, entry.ID)
+			q.finished++
+		}
+	}
+}
+
+// load replays the journal into the jobs
+func (q *FileQueue) load() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry outboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A partial last line is left by a crash during a write
+			continue
+		}
+		q.apply(entry, bytes.Clone(scanner.Bytes()))
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the journal with the lines of the jobs not done, must be
+// called with the lock held
+func (q *FileQueue) compact() error {
+	var data []byte
+	for _, oj := range q.sorted() {
+		for _, line := range [][]byte{oj.push, oj.attempt, oj.failed} {
+			if line != nil {
+				data = append(append(data, line...), '\n')
+			}
+		}
+	}
+
+	if err := writeFileAtomic(q.path, data); err != nil {
+		return err
+	}
+
+	q.finished = 0
+	return nil
+}
+
+// sorted returns the jobs not done in the order they were pushed
+func (q *FileQueue) sorted() []*outboxJob {
+	jobs := slices.Collect(maps.Values(q.jobs))
+	slices.SortFunc(jobs, func(a, b *outboxJob) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return jobs
+}
@@ -0,0 +1,254 @@
+package msgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+func TestFileQueueKeepsJobInterruptedByShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sending := make(chan struct{})
+	mail := &testMail{send: func(
+		ctx context.Context, opts provider.MailSendOpts,
+	) error {
+		close(sending)
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	client := newTestClient(t, ClientOpts{Queue: queue, QueueWorkers: 1}, mail)
+
+	if _, err := client.Enqueue(
+		context.Background(), welcomeOpts("ada@example.com"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	<-sending
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Shutdown(ctx); err == nil {
+		t.Fatal("expected the shutdown deadline to be exceeded")
+	}
+
+	reopened, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := len(reopened.mem.jobs); pending != 1 {
+		t.Fatalf("got %d pending jobs, want 1", pending)
+	}
+}
+
+func TestFileQueueReplaysJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"sent", "failed", "popped", "pending"} {
+		job := &Job{ID: id, Opts: welcomeOpts("ada@example.com")}
+		if err := queue.Push(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sendErr := range []error{nil, errors.New("rejected"), nil} {
+		job, err := queue.Pop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The third job is popped and not done, as after a crash
+		if job.ID == "popped" {
+			break
+		}
+		if err := queue.Done(ctx, job, sendErr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash during a write leaves a partial last line
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"op":"push","id":"par`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	reopened, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The push, attempt and failure of the failed job, the push and attempt
+	// of the popped one, and the push of the pending one
+	if lines := bytes.Count(data, []byte("\n")); lines != 6 {
+		t.Errorf("got %d journal lines after compaction, want 6", lines)
+	}
+
+	failed := reopened.Failed()
+	if len(failed) != 1 || failed[0].Job.ID != "failed" ||
+		failed[0].Error != "rejected" || failed[0].Job.Attempts != 1 {
+		t.Errorf("got failed jobs %+v, want the rejected job", failed)
+	}
+
+	want := []struct {
+		id       string
+		attempts int
+	}{{"popped", 2}, {"pending", 1}}
+	for _, want := range want {
+		job, err := reopened.Pop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.ID != want.id || job.Attempts != want.attempts {
+			t.Errorf("popped %s with %d attempts, want %s with %d",
+				job.ID, job.Attempts, want.id, want.attempts)
+		}
+		if job.Opts.Data["Name"] != "Ada" {
+			t.Errorf("got data %v for job %s", job.Opts.Data, job.ID)
+		}
+	}
+}
+
+func TestFileQueueRetriesAndDiscardsFailedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"retried", "discarded"} {
+		if err := queue.Push(ctx, &Job{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+		job, err := queue.Pop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := queue.Done(ctx, job, errors.New("unavailable")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := queue.Retry(ctx, "retried"); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Discard("discarded"); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Discard("retried"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("got %v discarding a retried job, want ErrJobNotFound", err)
+	}
+	if failed := queue.Failed(); len(failed) != 0 {
+		t.Errorf("got failed jobs %+v, want none", failed)
+	}
+
+	reopened, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := reopened.Pop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "retried" || job.Attempts != 2 {
+		t.Errorf("popped %s with %d attempts, want retried with 2",
+			job.ID, job.Attempts)
+	}
+	if len(reopened.Failed()) != 0 || len(reopened.mem.jobs) != 0 {
+		t.Errorf("got jobs left after reopening, want only the retried one")
+	}
+}
+
+func TestFileQueueCompactsWhileOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.compactAfter = 2
+
+	for _, id := range []string{"first", "second", "third"} {
+		if err := queue.Push(ctx, &Job{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		job, err := queue.Pop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := queue.Done(ctx, job, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 1 {
+		t.Errorf("got %d journal lines, want the push of the third job", lines)
+	}
+}
+
+func TestFileQueuePopKeepsJobWhenJournalFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ctx := context.Background()
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Push(ctx, &Job{ID: "job"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in place of the journal fails the writes
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Pop(ctx); err == nil {
+		t.Fatal("expected the pop to fail")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.Pop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "job" || job.Attempts != 1 {
+		t.Errorf("popped %s with %d attempts, want job with 1",
+			job.ID, job.Attempts)
+	}
+}
@@ -1,7 +1,10 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"sync"
 
 	"github.com/sideshow/apns2"
 	"github.com/sideshow/apns2/payload"
@@ -13,9 +16,15 @@ type ApplePushProvider struct {
 	TeamID            string
 	PrivateKey        string
 	NotificationTopic string
+
+	mu     sync.Mutex
+	client *apns2.Client
 }
 
-func (p *ApplePushProvider) Send(opts PushSendOpts) error {
+// Send pushes a notification to a device, and returns the APNs ID
+func (p *ApplePushProvider) Send(
+	ctx context.Context, opts PushSendOpts,
+) (string, error) {
 	alertData := map[string]string{"body": opts.Message}
 
 	if opts.Title != "" {
@@ -25,31 +34,64 @@ func (p *ApplePushProvider) Send(opts PushSendOpts) error {
 
 	pl := payload.NewPayload().Alert(alertData)
 
-	authKey, err := token.AuthKeyFromFile(p.PrivateKey)
+	client, err := p.getClient()
 	if err != nil {
-		return err
-	}
-
-	token := &token.Token{
-		AuthKey: authKey,
-		KeyID:   p.KeyID,
-		TeamID:  p.TeamID,
+		return "", err
 	}
 
-	client := apns2.NewTokenClient(token)
-
 	notification := apns2.Notification{
 		DeviceToken: opts.DeviceToken,
 		Topic:       p.NotificationTopic,
 		Payload:     pl,
 	}
 
-	res, err := client.Push(&notification)
+	res, err := client.PushWithContext(ctx, &notification)
 	if err != nil {
-		return err
+		return "", &ProviderError{Provider: "apple", Err: err}
+	}
+
+	if !res.Sent() {
+		return "", &ProviderError{
+			Provider:  "apple",
+			Code:      res.Reason,
+			Permanent: !appleRetryable(res),
+			Err:       fmt.Errorf("apns push failed: %d %s", res.StatusCode, res.Reason),
+		}
 	}
 
-	fmt.Println(res)
+	return res.ApnsID, nil
+}
+
+// The client is created on first use, and reused for every push
+func (p *ApplePushProvider) getClient() (*apns2.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	authKey, err := token.AuthKeyFromFile(p.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &token.Token{
+		AuthKey: authKey,
+		KeyID:   p.KeyID,
+		TeamID:  p.TeamID,
+	}
+
+	p.client = apns2.NewTokenClient(token)
+	return p.client, nil
+}
 
-	return nil
+// appleRetryable reports whether a failed push may succeed when sent again.
+// Throttling and server errors are retryable, as is an expired provider token
+// which is renewed on the next push. Errors such as BadDeviceToken or
+// Unregistered are permanent.
+func appleRetryable(res *apns2.Response) bool {
+	return res.StatusCode == http.StatusTooManyRequests ||
+		res.StatusCode >= http.StatusInternalServerError ||
+		res.Reason == apns2.ReasonExpiredProviderToken
 }
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrPlatformNotConfigured is the error of a push device whose platform has no
+// provider set
+var ErrPlatformNotConfigured = errors.New("push platform not configured")
+
+// ProviderError is a failure reported by a provider, with its classification
+type ProviderError struct {
+	Provider  string
+	Code      string // Provider specific error code or reason
+	Permanent bool   // Retrying will fail the same way
+	Err       error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err should not be retried, either because the
+// provider classified it as permanent or because the context is done.
+func IsPermanent(err error) bool {
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Permanent
+	}
+
+	return false
+}
+
+// IsRetryable reports whether sending again may succeed. Errors not
+// classified by a provider, such as network errors, are retryable.
+func IsRetryable(err error) bool {
+	return err != nil && !IsPermanent(err)
+}
+
+// ErrorMessage returns the message of err, or an empty string if it is nil
+func ErrorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// MessageError returns an error with the message, or nil if it is empty. It
+// restores errors encoded with ErrorMessage.
+func MessageError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+// MarshalWithError encodes v, a struct with an Error field of type error, with
+// the error as its message, so results can be saved. v is usually a local
+// alias of the type, so its own MarshalJSON is not called again.
+func MarshalWithError[T any](v T) ([]byte, error) {
+	field := reflect.ValueOf(&v).Elem().FieldByName("Error")
+	fieldErr, _ := field.Interface().(error)
+	field.SetZero()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	delete(fields, "Error")
+	if fieldErr != nil {
+		fields["Error"], _ = json.Marshal(fieldErr.Error())
+	}
+
+	return json.Marshal(fields)
+}
+
+// UnmarshalWithError decodes data encoded with MarshalWithError into v,
+// restoring the Error field with MessageError.
+func UnmarshalWithError[T any](data []byte, v *T) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var message string
+	if raw, ok := fields["Error"]; ok {
+		if err := json.Unmarshal(raw, &message); err != nil {
+			return err
+		}
+		delete(fields, "Error")
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	restored := MessageError(message)
+	reflect.ValueOf(v).Elem().FieldByName("Error").
+		Set(reflect.ValueOf(&restored).Elem())
+	return nil
+}
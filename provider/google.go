@@ -2,27 +2,32 @@ package provider
 
 import (
 	"context"
+	"sync"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	option "google.golang.org/api/option"
 )
 
+// Max tokens per FCM multicast request
+const googleMulticastSize = 500
+
 type GooglePushProvider struct {
 	ServiceAccountKey string // path to .json key file
-}
 
-func (p *GooglePushProvider) Send(opts PushSendOpts) error {
-	keyOpt := option.WithCredentialsFile(p.ServiceAccountKey)
+	mu     sync.Mutex
+	client *messaging.Client
+}
 
-	app, err := firebase.NewApp(context.Background(), nil, keyOpt)
+// Send pushes a notification to a device, and returns the FCM message ID
+func (p *GooglePushProvider) Send(
+	ctx context.Context, opts PushSendOpts,
+) (string, error) {
+	client, err := p.getClient(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	ctx := context.Background()
-	client, err := app.Messaging(ctx)
-
 	message := &messaging.Message{
 		Token: opts.DeviceToken,
 		Notification: &messaging.Notification{
@@ -31,10 +36,105 @@ func (p *GooglePushProvider) Send(opts PushSendOpts) error {
 		},
 	}
 
-	_, err = client.Send(ctx, message)
+	messageID, err := client.Send(ctx, message)
+	if err != nil {
+		return "", classifyGoogle(err)
+	}
+
+	return messageID, nil
+}
+
+// SendMulticast pushes the same notification to many devices using FCM
+// multicast, split in requests of up to 500 tokens. It returns a result for
+// each token, in the same order.
+func (p *GooglePushProvider) SendMulticast(
+	ctx context.Context, tokens []string, title string, body string,
+) ([]PushResult, error) {
+	client, err := p.getClient(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	results := make([]PushResult, 0, len(tokens))
+
+	for start := 0; start < len(tokens); start += googleMulticastSize {
+		end := min(start+googleMulticastSize, len(tokens))
+
+		batch, err := client.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+			Tokens: tokens[start:end],
+			Notification: &messaging.Notification{
+				Title: title,
+				Body:  body,
+			},
+		})
+		if err != nil {
+			return results, classifyGoogle(err)
+		}
+
+		for i, token := range tokens[start:end] {
+			res := PushResult{DeviceToken: token, Platform: PushPlatformGoogle}
+			if i < len(batch.Responses) {
+				res.MessageID = batch.Responses[i].MessageID
+				if err := batch.Responses[i].Error; err != nil {
+					res.Error = classifyGoogle(err)
+				}
+			}
+			results = append(results, res)
+		}
+	}
+
+	return results, nil
+}
+
+// The client is created on first use, and reused for every push
+func (p *GooglePushProvider) getClient(
+	ctx context.Context,
+) (*messaging.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	keyOpt := option.WithCredentialsFile(p.ServiceAccountKey)
+
+	app, err := firebase.NewApp(ctx, nil, keyOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = client
+	return p.client, nil
+}
+
+// classifyGoogle wraps err in a ProviderError. Invalid or unregistered tokens
+// and credential errors are permanent, while quota and availability errors are
+// retryable.
+func classifyGoogle(err error) error {
+	providerErr := &ProviderError{Provider: "google", Err: err}
+
+	switch {
+	case messaging.IsUnregistered(err):
+		providerErr.Code, providerErr.Permanent = "UNREGISTERED", true
+	case messaging.IsInvalidArgument(err):
+		providerErr.Code, providerErr.Permanent = "INVALID_ARGUMENT", true
+	case messaging.IsSenderIDMismatch(err):
+		providerErr.Code, providerErr.Permanent = "SENDER_ID_MISMATCH", true
+	case messaging.IsThirdPartyAuthError(err):
+		providerErr.Code, providerErr.Permanent = "THIRD_PARTY_AUTH_ERROR", true
+	case messaging.IsQuotaExceeded(err):
+		providerErr.Code = "QUOTA_EXCEEDED"
+	case messaging.IsUnavailable(err):
+		providerErr.Code = "UNAVAILABLE"
+	case messaging.IsInternal(err):
+		providerErr.Code = "INTERNAL"
 	}
 
-	return nil
+	return providerErr
 }
@@ -1,15 +1,121 @@
 package provider
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// MailAddress is an email address with an optional display name
+type MailAddress struct {
+	Name    string
+	Address string
+}
+
+// ParseMailAddress parses an address such as "Bob <bob@example.org>"
+func ParseMailAddress(address string) (MailAddress, error) {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return MailAddress{}, err
+	}
+	return MailAddress{Name: addr.Name, Address: addr.Address}, nil
+}
+
+// Validate checks the address is a bare addr-spec such as bob@example.org,
+// with any display name set in Name
+func (a MailAddress) Validate() error {
+	parsed, err := mail.ParseAddress(a.Address)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Name != "" || parsed.Address != a.Address {
+		return fmt.Errorf("invalid address %q, not a bare address", a.Address)
+	}
+	return nil
+}
+
+// String formats the address for a header, encoding the name when needed
+func (a MailAddress) String() string {
+	return (&mail.Address{Name: a.Name, Address: a.Address}).String()
+}
+
+// JoinMailAddresses formats addresses as a header address list
+func JoinMailAddresses(addresses []MailAddress) string {
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = address.String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Attachment is a file attached to a mail. Attachments with a ContentID are
+// shown inline, referenced from the HTML body as cid:ContentID.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	ContentID   string
+}
+
 // Mail channel types
 type MailSendOpts struct {
-	To       string
-	From     string
-	ReplyTo  string
-	Subject  string
-	HTMLBody string
-	TextBody string
+	To          []MailAddress
+	Cc          []MailAddress
+	Bcc         []MailAddress
+	From        string
+	ReplyTo     string
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Attachments []Attachment
+	Headers     map[string]string
+	// Providers without tags, metadata or streams leave them out
+	Tag           string
+	Metadata      map[string]string
+	MessageStream string
+}
+
+// ValidateMailHeaders checks the header names are printable ASCII without a
+// colon, and the values are on a single line.
+func ValidateMailHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" {
+			return errors.New("empty header name")
+		}
+
+		for _, c := range name {
+			if c < 33 || c > 126 || c == ':' {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+		}
+
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid header %s value %q", name, value)
+		}
+	}
+	return nil
+}
+
+type MailSendResult struct {
+	MessageID string
 }
 
 type MailProvider interface {
-	Send(opts MailSendOpts) error
+	Name() string
+	Send(ctx context.Context, opts MailSendOpts) (*MailSendResult, error)
+}
+
+type MailBatchResult struct {
+	MessageID string
+	Error     error
+}
+
+// BatchMailProvider is implemented by mail providers with a batch endpoint.
+// SendBatch returns a result for each of opts, in the same order.
+type BatchMailProvider interface {
+	MailProvider
+	SendBatch(ctx context.Context, opts []MailSendOpts) ([]MailBatchResult, error)
 }
@@ -0,0 +1,24 @@
+package provider
+
+import "testing"
+
+func TestMailAddressValidate(t *testing.T) {
+	tests := []struct {
+		address MailAddress
+		valid   bool
+	}{
+		{MailAddress{Address: "bob@example.org"}, true},
+		{MailAddress{Name: "Bob Smith", Address: "bob@example.org"}, true},
+		{MailAddress{Address: "not an address"}, false},
+		{MailAddress{Name: "Acc", Address: "Evil <x@y.z>"}, false},
+		{MailAddress{Address: "<bob@example.org>"}, false},
+		{MailAddress{Address: " bob@example.org"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.address.Validate()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%+v: got error %v, want valid %v", test.address, err, test.valid)
+		}
+	}
+}
@@ -2,27 +2,181 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
 
 	"github.com/mrz1836/postmark"
 )
 
+// Max emails per Postmark batch request
+const postmarkBatchSize = 500
+
 type PostmarkProvider struct {
 	ServerToken string
 	TrackOpens  bool
+
+	clientOnce sync.Once
+	client     *postmark.Client
+}
+
+func (p *PostmarkProvider) Name() string {
+	return "postmark"
+}
+
+func (p *PostmarkProvider) Send(
+	ctx context.Context, opts MailSendOpts,
+) (*MailSendResult, error) {
+	res, err := p.getClient().SendEmail(ctx, p.email(opts))
+	if err != nil {
+		return nil, p.classify(err, res.ErrorCode)
+	}
+
+	return &MailSendResult{MessageID: res.MessageID}, nil
+}
+
+// SendBatch sends emails using the Postmark batch endpoint, split in requests
+// of up to 500 emails.
+func (p *PostmarkProvider) SendBatch(
+	ctx context.Context, opts []MailSendOpts,
+) ([]MailBatchResult, error) {
+	results := make([]MailBatchResult, 0, len(opts))
+
+	for start := 0; start < len(opts); start += postmarkBatchSize {
+		end := min(start+postmarkBatchSize, len(opts))
+
+		emails := make([]postmark.Email, 0, end-start)
+		for _, o := range opts[start:end] {
+			emails = append(emails, p.email(o))
+		}
+
+		responses, err := p.getClient().SendEmailBatch(ctx, emails)
+		if err != nil {
+			return results, p.classify(err, 0)
+		}
+
+		for i := range emails {
+			if i >= len(responses) {
+				results = append(results, MailBatchResult{
+					Error: errors.New("postmark batch: missing response"),
+				})
+				continue
+			}
+
+			res := responses[i]
+			if res.ErrorCode != 0 {
+				err := fmt.Errorf("%v %s", res.ErrorCode, res.Message)
+				results = append(results, MailBatchResult{
+					Error: p.classify(err, res.ErrorCode),
+				})
+				continue
+			}
+
+			results = append(results, MailBatchResult{MessageID: res.MessageID})
+		}
+	}
+
+	return results, nil
 }
 
-func (p *PostmarkProvider) Send(opts MailSendOpts) error {
-	email := postmark.Email{
-		From:       opts.From,
-		To:         opts.To,
-		ReplyTo:    opts.ReplyTo,
-		Subject:    opts.Subject,
-		HTMLBody:   opts.HTMLBody,
-		TextBody:   opts.TextBody,
-		TrackOpens: p.TrackOpens,
+// Postmark error codes rejecting the email or the account, which fail the
+// same way when retried. See
+// https://postmarkapp.com/developer/api/overview#error-codes
+var postmarkPermanentCodes = []int64{
+	10,  // Bad or missing API token
+	300, // Invalid email request
+	400, // Sender signature not found
+	401, // Sender signature not confirmed
+	402, // Invalid JSON
+	403, // Incompatible JSON
+	405, // Not allowed to send
+	406, // Inactive recipient
+	409, // JSON required
+	410, // Too many batch messages
+	411, // Forbidden attachment type
+	412, // Account is pending
+	413, // Account may not send
+}
+
+// classify wraps err in a ProviderError. Errors with a permanent Postmark
+// error code are rejections, while other codes such as 100 (maintenance),
+// network errors and server errors are retryable.
+func (p *PostmarkProvider) classify(err error, errorCode int64) error {
+	var apiErr postmark.APIError
+	if errors.As(err, &apiErr) {
+		errorCode = apiErr.ErrorCode
+	}
+
+	code := ""
+	if errorCode != 0 {
+		code = strconv.FormatInt(errorCode, 10)
+	}
+
+	return &ProviderError{
+		Provider:  p.Name(),
+		Code:      code,
+		Permanent: slices.Contains(postmarkPermanentCodes, errorCode),
+		Err:       err,
+	}
+}
+
+func (p *PostmarkProvider) email(opts MailSendOpts) postmark.Email {
+	return postmark.Email{
+		From:          opts.From,
+		To:            JoinMailAddresses(opts.To),
+		Cc:            JoinMailAddresses(opts.Cc),
+		Bcc:           JoinMailAddresses(opts.Bcc),
+		ReplyTo:       opts.ReplyTo,
+		Subject:       opts.Subject,
+		HTMLBody:      opts.HTMLBody,
+		TextBody:      opts.TextBody,
+		TrackOpens:    p.TrackOpens,
+		Attachments:   postmarkAttachments(opts.Attachments),
+		Headers:       postmarkHeaders(opts.Headers),
+		Tag:           opts.Tag,
+		Metadata:      opts.Metadata,
+		MessageStream: opts.MessageStream,
 	}
+}
+
+// postmarkHeaders converts the headers, sorted by name
+func postmarkHeaders(headers map[string]string) []postmark.Header {
+	converted := make([]postmark.Header, 0, len(headers))
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		converted = append(converted, postmark.Header{
+			Name: name, Value: headers[name],
+		})
+	}
+	return converted
+}
+
+func postmarkAttachments(attachments []Attachment) []postmark.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	converted := make([]postmark.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		converted[i] = postmark.Attachment{
+			Name:        attachment.Filename,
+			Content:     base64.StdEncoding.EncodeToString(attachment.Content),
+			ContentType: attachment.ContentType,
+		}
+		if attachment.ContentID != "" {
+			converted[i].ContentID = "cid:" + attachment.ContentID
+		}
+	}
+	return converted
+}
 
-	client := postmark.NewClient(p.ServerToken, "")
-	_, err := client.SendEmail(context.Background(), email)
-	return err
+// The client is created once, and reused for every send
+func (p *PostmarkProvider) getClient() *postmark.Client {
+	p.clientOnce.Do(func() {
+		p.client = postmark.NewClient(p.ServerToken, "")
+	})
+	return p.client
 }
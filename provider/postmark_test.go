@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mrz1836/postmark"
+)
+
+func TestPostmarkClassify(t *testing.T) {
+	p := &PostmarkProvider{}
+
+	tests := []struct {
+		name      string
+		err       error
+		errorCode int64
+		permanent bool
+	}{
+		{"inactive recipient", postmark.APIError{ErrorCode: 406}, 0, true},
+		{"invalid request", errors.New("300 Invalid email request"), 300, true},
+		{"maintenance", postmark.APIError{ErrorCode: 100}, 0, false},
+		{"unknown code", postmark.APIError{ErrorCode: 429}, 0, false},
+		{"network error", errors.New("connection reset"), 0, false},
+	}
+
+	for _, test := range tests {
+		err := p.classify(test.err, test.errorCode)
+		if permanent := IsPermanent(err); permanent != test.permanent {
+			t.Errorf("%s: got permanent %v, want %v", test.name, permanent, test.permanent)
+		}
+	}
+}
+
+func TestPostmarkAttachments(t *testing.T) {
+	attachments := postmarkAttachments([]Attachment{
+		{
+			Filename: "logo.png", ContentType: "image/png",
+			Content: []byte("png"), ContentID: "logo",
+		},
+		{Filename: "terms.txt", ContentType: "text/plain", Content: []byte("Terms")},
+	})
+
+	want := []postmark.Attachment{
+		{
+			Name: "logo.png", ContentType: "image/png",
+			Content:   base64.StdEncoding.EncodeToString([]byte("png")),
+			ContentID: "cid:logo",
+		},
+		{
+			Name: "terms.txt", ContentType: "text/plain",
+			Content: base64.StdEncoding.EncodeToString([]byte("Terms")),
+		},
+	}
+	if !slices.Equal(attachments, want) {
+		t.Errorf("got attachments %+v, want %+v", attachments, want)
+	}
+
+	if attachments := postmarkAttachments(nil); attachments != nil {
+		t.Errorf("got attachments %+v without any, want nil", attachments)
+	}
+}
@@ -1,8 +1,11 @@
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
 )
 
 const (
@@ -10,6 +13,9 @@ const (
 	PushPlatformGoogle PushPlatform = "google"
 )
 
+// Number of devices pushed to concurrently when no limit is set
+const DefaultPushConcurrency = 10
+
 type PushPlatform string
 
 // SMS channel types
@@ -18,8 +24,13 @@ type SMSProviderSendOpts struct {
 	Body string
 }
 
+type SMSSendResult struct {
+	MessageID string
+}
+
 type SMSProvider interface {
-	Send(opts SMSProviderSendOpts) error
+	Name() string
+	Send(ctx context.Context, opts SMSProviderSendOpts) (*SMSSendResult, error)
 }
 
 // App push channel types
@@ -29,16 +40,42 @@ type PushDevice struct {
 }
 
 type PushProviderSendOpts struct {
-	Devices []PushDevice
-	Title   string
-	Body    string
+	Devices     []PushDevice
+	Title       string
+	Body        string
+	Concurrency int // Max devices pushed to concurrently
+	// Called before pushing to each device of a platform, with n set to 1.
+	// The device fails with the error returned.
+	Limit func(ctx context.Context, platform PushPlatform, n int) error
+}
+
+func (opts PushProviderSendOpts) limit(
+	ctx context.Context, platform PushPlatform, n int,
+) error {
+	if opts.Limit == nil {
+		return nil
+	}
+	return opts.Limit(ctx, platform, n)
 }
 
 type PushResult struct {
 	DeviceToken string
+	Platform    PushPlatform
+	MessageID   string // Message ID returned by the platform
 	Error       error
 }
 
+// MarshalJSON encodes the error as its message, so results can be saved
+func (r PushResult) MarshalJSON() ([]byte, error) {
+	type alias PushResult
+	return MarshalWithError(alias(r))
+}
+
+func (r *PushResult) UnmarshalJSON(data []byte) error {
+	type alias PushResult
+	return UnmarshalWithError(data, (*alias)(r))
+}
+
 type PushProviders struct {
 	AppleProvider  *ApplePushProvider
 	GoogleProvider *GooglePushProvider
@@ -59,30 +96,167 @@ func (e *PushSendError) Error() string {
 	return fmt.Sprintf("push send failed: %v", e.ProviderError)
 }
 
-func (pp *PushProviders) Send(opts PushProviderSendOpts) error {
+// Send pushes to every device concurrently, with at most opts.Concurrency
+// pushes in flight, and returns the result for each of them in the order of
+// opts.Devices. Google devices are sent in a single multicast when there are
+// more than one. The returned error joins a PushSendError for each device
+// that failed.
+func (pp *PushProviders) Send(
+	ctx context.Context, opts PushProviderSendOpts,
+) ([]PushResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPushConcurrency
+	}
+
+	results := make([]PushResult, len(opts.Devices))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	// Index of google devices in opts.Devices, to be sent via multicast
+	var multicast []int
+	if pp.GoogleProvider != nil {
+		for i, device := range opts.Devices {
+			if device.Platform == PushPlatformGoogle {
+				multicast = append(multicast, i)
+			}
+		}
+	}
+	if len(multicast) > 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pp.sendMulticast(ctx, opts, multicast, results)
+		}()
+	} else {
+		multicast = nil
+	}
+
+	for i, device := range opts.Devices {
+		if slices.Contains(multicast, i) {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = pp.sendDevice(ctx, device, opts)
+		}()
+	}
+	wg.Wait()
+
 	var errs []error
+	for _, res := range results {
+		if res.Error != nil {
+			errs = append(errs, &PushSendError{
+				DeviceToken: res.DeviceToken, ProviderError: res.Error,
+			})
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// sendMulticast sends to the google devices at indexes of opts.Devices, and
+// stores their result at the same indexes of results.
+func (pp *PushProviders) sendMulticast(
+	ctx context.Context, opts PushProviderSendOpts, indexes []int,
+	results []PushResult,
+) {
+	tokens := make([]string, len(indexes))
+	for i, index := range indexes {
+		tokens[i] = opts.Devices[index].Token
+	}
 
-	for _, device := range opts.Devices {
-		var err error
-		pushSendOpts := PushSendOpts{
-			DeviceToken: device.Token, Title: opts.Title, Message: opts.Body,
+	// Limits are taken for each device, those over the limit are left out
+	var allowed []int
+	var allowedTokens []string
+	for i, index := range indexes {
+		if err := opts.limit(ctx, PushPlatformGoogle, 1); err != nil {
+			results[index] = PushResult{
+				DeviceToken: tokens[i], Platform: PushPlatformGoogle, Error: err,
+			}
+			continue
 		}
+		allowed = append(allowed, index)
+		allowedTokens = append(allowedTokens, tokens[i])
+	}
+	if len(allowed) == 0 {
+		return
+	}
+
+	multicastResults, err := pp.GoogleProvider.SendMulticast(
+		ctx, allowedTokens, opts.Title, opts.Body,
+	)
 
-		switch device.Platform {
-		case PushPlatformApple:
-			err = pp.AppleProvider.Send(pushSendOpts)
-		case PushPlatformGoogle:
-			err = pp.GoogleProvider.Send(pushSendOpts)
-		default:
-			err = fmt.Errorf("unsupported platform: %s", device.Platform)
+	for i, index := range allowed {
+		res := PushResult{
+			DeviceToken: allowedTokens[i], Platform: PushPlatformGoogle,
 		}
+		if i < len(multicastResults) {
+			res = multicastResults[i]
+		} else {
+			res.Error = err
+		}
+		results[index] = res
+	}
+}
 
-		if err != nil {
-			errs = append(
-				errs, &PushSendError{DeviceToken: device.Token, ProviderError: err},
-			)
+func (pp *PushProviders) sendDevice(
+	ctx context.Context, device PushDevice, opts PushProviderSendOpts,
+) PushResult {
+	res := PushResult{DeviceToken: device.Token, Platform: device.Platform}
+
+	if err := ctx.Err(); err != nil {
+		res.Error = err
+		return res
+	}
+
+	if pp.missingProvider(device.Platform) {
+		res.Error = &ProviderError{
+			Provider:  string(device.Platform),
+			Permanent: true,
+			Err:       ErrPlatformNotConfigured,
 		}
+		return res
+	}
+
+	if err := opts.limit(ctx, device.Platform, 1); err != nil {
+		res.Error = err
+		return res
+	}
+
+	pushSendOpts := PushSendOpts{
+		DeviceToken: device.Token, Title: opts.Title, Message: opts.Body,
+	}
+
+	switch device.Platform {
+	case PushPlatformApple:
+		res.MessageID, res.Error = pp.AppleProvider.Send(ctx, pushSendOpts)
+	case PushPlatformGoogle:
+		res.MessageID, res.Error = pp.GoogleProvider.Send(ctx, pushSendOpts)
+	default:
+		res.Error = fmt.Errorf("unsupported platform: %s", device.Platform)
 	}
 
-	return errors.Join(errs...)
+	return res
+}
+
+// missingProvider reports whether the platform is supported but has no
+// provider set
+func (pp *PushProviders) missingProvider(platform PushPlatform) bool {
+	switch platform {
+	case PushPlatformApple:
+		return pp.AppleProvider == nil
+	case PushPlatformGoogle:
+		return pp.GoogleProvider == nil
+	default:
+		return false
+	}
 }
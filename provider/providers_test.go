@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPushWithoutPlatformProvider(t *testing.T) {
+	providers := &PushProviders{}
+
+	results, err := providers.Send(context.Background(), PushProviderSendOpts{
+		Devices: []PushDevice{
+			{Token: "apple-token", Platform: PushPlatformApple},
+			{Token: "google-a", Platform: PushPlatformGoogle},
+			{Token: "google-b", Platform: PushPlatformGoogle},
+		},
+	})
+	if err == nil {
+		t.Error("expected the devices to fail")
+	}
+
+	for _, res := range results {
+		if !errors.Is(res.Error, ErrPlatformNotConfigured) ||
+			!IsPermanent(res.Error) {
+			t.Errorf("got %v for %s, want a permanent ErrPlatformNotConfigured",
+				res.Error, res.DeviceToken)
+		}
+	}
+}
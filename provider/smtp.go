@@ -0,0 +1,366 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPProvider sends mail through an SMTP server, using STARTTLS when the
+// server supports it.
+type SMTPProvider struct {
+	Host     string
+	Port     int // Defaults to 587
+	Username string
+	Password string
+}
+
+func (p *SMTPProvider) Name() string {
+	return "smtp"
+}
+
+func (p *SMTPProvider) Send(
+	ctx context.Context, opts MailSendOpts,
+) (*MailSendResult, error) {
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, &ProviderError{Provider: p.Name(), Permanent: true, Err: err}
+	}
+
+	if err := ValidateMailHeaders(opts.Headers); err != nil {
+		return nil, &ProviderError{Provider: p.Name(), Permanent: true, Err: err}
+	}
+
+	// Bcc recipients are left out of the headers
+	var rcpts []string
+	for _, list := range [][]MailAddress{opts.To, opts.Cc, opts.Bcc} {
+		for _, addr := range list {
+			if err := addr.Validate(); err != nil {
+				return nil, &ProviderError{
+					Provider: p.Name(), Permanent: true, Err: err,
+				}
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+
+	messageID := p.messageID(from.Address)
+
+	body, err := p.message(opts, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.send(ctx, from.Address, rcpts, body); err != nil {
+		return nil, p.classify(err)
+	}
+
+	return &MailSendResult{MessageID: messageID}, nil
+}
+
+func (p *SMTPProvider) send(
+	ctx context.Context, from string, to []string, body []byte,
+) error {
+	port := p.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(p.Host, strconv.Itoa(port))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// Bound the whole SMTP exchange by the context
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, p.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: p.Host}); err != nil {
+			return err
+		}
+	}
+
+	if p.Username != "" {
+		auth := smtp.PlainAuth("", p.Username, p.Password, p.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// message builds the message headers and body. The text and HTML bodies
+// are alternatives, nested with the inline images in a multipart/related part
+// and with the other attachments in a multipart/mixed part.
+func (p *SMTPProvider) message(
+	opts MailSendOpts, messageID string,
+) ([]byte, error) {
+	var inline, attached []Attachment
+	for _, attachment := range opts.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+
+	writeBody := func(w io.Writer) (string, error) {
+		return writeAlternative(w, opts)
+	}
+	if len(inline) > 0 {
+		writeBody = writeNested("multipart/related", writeBody, inline)
+	}
+	if len(attached) > 0 {
+		writeBody = writeNested("multipart/mixed", writeBody, attached)
+	}
+
+	var body bytes.Buffer
+	contentType, err := writeBody(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := [][2]string{
+		{"From", opts.From},
+		{"To", JoinMailAddresses(opts.To)},
+		{"Cc", JoinMailAddresses(opts.Cc)},
+		{"Reply-To", opts.ReplyTo},
+		{"Subject", mime.QEncoding.Encode("utf-8", opts.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", contentType},
+	}
+
+	// Custom headers come last, and are left out when generated above
+	for _, name := range slices.Sorted(maps.Keys(opts.Headers)) {
+		generated := slices.ContainsFunc(headers, func(header [2]string) bool {
+			return strings.EqualFold(header[0], name)
+		})
+		if !generated {
+			value := mime.QEncoding.Encode("utf-8", opts.Headers[name])
+			headers = append(headers, [2]string{name, value})
+		}
+	}
+
+	var head bytes.Buffer
+	for _, header := range headers {
+		if header[1] != "" {
+			fmt.Fprintf(&head, "%s: %s\r\n", header[0], header[1])
+		}
+	}
+	head.WriteString("\r\n")
+
+	return append(head.Bytes(), body.Bytes()...), nil
+}
+
+// writeAlternative writes the text and HTML bodies as a multipart/alternative
+// part, and returns its content type.
+func writeAlternative(w io.Writer, opts MailSendOpts) (string, error) {
+	parts := multipart.NewWriter(w)
+
+	bodies := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", opts.TextBody},
+		{"text/html", opts.HTMLBody},
+	}
+
+	for _, b := range bodies {
+		if b.body == "" {
+			continue
+		}
+
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {b.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(b.body)); err != nil {
+			return "", err
+		}
+		if err := qp.Close(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(
+		"multipart/alternative; boundary=%q", parts.Boundary(),
+	), nil
+}
+
+// writeNested returns a writer of a multipart part of the given type, with
+// the part written by inner followed by the attachments.
+func writeNested(
+	multipartType string,
+	inner func(w io.Writer) (string, error),
+	attachments []Attachment,
+) func(w io.Writer) (string, error) {
+	return func(w io.Writer) (string, error) {
+		parts := multipart.NewWriter(w)
+
+		var innerBody bytes.Buffer
+		innerType, err := inner(&innerBody)
+		if err != nil {
+			return "", err
+		}
+
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {innerType},
+		})
+		if err != nil {
+			return "", err
+		}
+		if _, err := part.Write(innerBody.Bytes()); err != nil {
+			return "", err
+		}
+
+		for _, attachment := range attachments {
+			if err := writeAttachment(parts, attachment); err != nil {
+				return "", err
+			}
+		}
+
+		if err := parts.Close(); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(
+			"%s; boundary=%q", multipartType, parts.Boundary(),
+		), nil
+	}
+}
+
+// writeAttachment writes the attachment as a base64 encoded part
+func writeAttachment(parts *multipart.Writer, attachment Attachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	disposition := "attachment"
+	if attachment.ContentID != "" {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition": {mime.FormatMediaType(
+			disposition, map[string]string{"filename": attachment.Filename},
+		)},
+	}
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+
+	part, err := parts.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// Base64 lines are limited to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 0 {
+		line := encoded[:min(76, len(encoded))]
+		encoded = encoded[len(line):]
+
+		if _, err := io.WriteString(part, line+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *SMTPProvider) messageID(from string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	domain := p.Host
+	if at := strings.LastIndexByte(from, '@'); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// classify wraps err in a ProviderError. SMTP 5xx replies are permanent, while
+// 4xx replies and network errors are retryable.
+func (p *SMTPProvider) classify(err error) error {
+	providerErr := &ProviderError{Provider: p.Name(), Err: err}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		providerErr.Code = strconv.Itoa(protoErr.Code)
+		providerErr.Permanent = protoErr.Code >= 500
+	}
+
+	return providerErr
+}
@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// mimePart is a parsed part of a message, with its nested parts
+type mimePart struct {
+	mediaType string
+	header    map[string][]string
+	body      []byte
+	parts     []mimePart
+}
+
+// parseMIMEPart parses a part with the content type, reading nested
+// multipart parts.
+func parseMIMEPart(
+	t *testing.T, contentType string, header map[string][]string, body io.Reader,
+) mimePart {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := mimePart{mediaType: mediaType, header: header}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		if part.body, err = io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		}
+		return part
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		// Raw parts keep the encoded body and Content-Transfer-Encoding
+		nested, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.parts = append(part.parts, parseMIMEPart(
+			t, nested.Header.Get("Content-Type"), nested.Header, nested,
+		))
+	}
+	return part
+}
+
+// mediaTypes returns the media types of the nested parts
+func (part mimePart) mediaTypes() []string {
+	var types []string
+	for _, nested := range part.parts {
+		types = append(types, nested.mediaType)
+	}
+	return types
+}
+
+func TestSMTPMessage(t *testing.T) {
+	logo := bytes.Repeat([]byte{0xff, 0xd8, 0x00, 0x7f}, 50)
+	p := &SMTPProvider{Host: "smtp.example.com"}
+
+	opts := MailSendOpts{
+		From:     "Fyro <hello@example.com>",
+		To:       []MailAddress{{Name: "Ada", Address: "ada@example.com"}},
+		Bcc:      []MailAddress{{Address: "hidden@example.com"}},
+		Subject:  "Grüße aus Köln",
+		TextBody: "Hello Ada",
+		HTMLBody: `<p>Hello Ada</p><img src="cid:logo">`,
+		Headers: map[string]string{
+			"X-Campaign": "Café",
+			"subject":    "Replaced",
+		},
+		Attachments: []Attachment{
+			{
+				Filename: "logo.jpg", ContentType: "image/jpeg",
+				Content: logo, ContentID: "logo",
+			},
+			{Filename: "terms.txt", Content: []byte("Terms")},
+		},
+	}
+
+	raw, err := p.message(opts, "<id@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != opts.Subject {
+		t.Errorf("got subject %q (%v), want %q", subject, err, opts.Subject)
+	}
+	campaign, err := decoder.DecodeHeader(msg.Header.Get("X-Campaign"))
+	if err != nil || campaign != "Café" {
+		t.Errorf("got X-Campaign %q (%v), want Café", campaign, err)
+	}
+	if subjects := msg.Header["Subject"]; len(subjects) != 1 {
+		t.Errorf("got subjects %q, want the custom one left out", subjects)
+	}
+	if msg.Header.Get("Bcc") != "" || strings.Contains(string(raw), "hidden@") {
+		t.Error("got the Bcc recipient in the message")
+	}
+	if msg.Header.Get("Message-ID") != "<id@example.com>" {
+		t.Errorf("got Message-ID %q", msg.Header.Get("Message-ID"))
+	}
+
+	// mixed(related(alternative(text, html), logo), terms)
+	mixed := parseMIMEPart(t, msg.Header.Get("Content-Type"), msg.Header, msg.Body)
+	if got := strings.Join(mixed.mediaTypes(), ","); mixed.mediaType !=
+		"multipart/mixed" || got != "multipart/related,application/octet-stream" {
+		t.Fatalf("got %s of %s, want mixed of related and the attachment",
+			mixed.mediaType, got)
+	}
+
+	related := mixed.parts[0]
+	if got := strings.Join(related.mediaTypes(), ","); got !=
+		"multipart/alternative,image/jpeg" {
+		t.Fatalf("got related parts %s, want alternative and the image", got)
+	}
+
+	alternative := related.parts[0]
+	if got := strings.Join(alternative.mediaTypes(), ","); got !=
+		"text/plain,text/html" {
+		t.Errorf("got alternative parts %s, want text and HTML", got)
+	}
+
+	image := related.parts[1]
+	if cid := mail.Header(image.header).Get("Content-ID"); cid != "<logo>" {
+		t.Errorf("got Content-ID %q, want <logo>", cid)
+	}
+	disposition, params, _ := mime.ParseMediaType(
+		mail.Header(image.header).Get("Content-Disposition"),
+	)
+	if disposition != "inline" || params["filename"] != "logo.jpg" {
+		t.Errorf("got disposition %s %v, want inline logo.jpg",
+			disposition, params)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(image.body), "\r\n"), "\r\n")
+	for _, line := range lines {
+		if len(line) > 76 {
+			t.Errorf("got base64 line of %d characters, want at most 76",
+				len(line))
+		}
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil || !bytes.Equal(content, logo) {
+		t.Errorf("got image content %x (%v), want the logo", content, err)
+	}
+	if len(lines) != 4 {
+		t.Errorf("got %d base64 lines, want 4", len(lines))
+	}
+
+	terms := mixed.parts[1]
+	disposition, _, _ = mime.ParseMediaType(
+		mail.Header(terms.header).Get("Content-Disposition"),
+	)
+	if terms.mediaType != "application/octet-stream" ||
+		disposition != "attachment" ||
+		mail.Header(terms.header).Get("Content-ID") != "" {
+		t.Errorf("got attachment %s %s, want an octet-stream attachment",
+			terms.mediaType, disposition)
+	}
+}
+
+func TestSMTPMessageWithoutAttachments(t *testing.T) {
+	p := &SMTPProvider{Host: "smtp.example.com"}
+
+	raw, err := p.message(MailSendOpts{
+		From: "hello@example.com", To: []MailAddress{{Address: "ada@example.com"}},
+		Subject: "Hello", TextBody: "Hello Ada",
+	}, "<id@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := parseMIMEPart(t, msg.Header.Get("Content-Type"), msg.Header, msg.Body)
+	if root.mediaType != "multipart/alternative" ||
+		strings.Join(root.mediaTypes(), ",") != "text/plain" {
+		t.Errorf("got %s of %v, want alternative with only the text",
+			root.mediaType, root.mediaTypes())
+	}
+	if msg.Header.Get("Subject") != "Hello" || msg.Header.Get("Cc") != "" {
+		t.Errorf("got headers %v", msg.Header)
+	}
+}
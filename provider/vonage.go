@@ -1,11 +1,19 @@
 package provider
 
+import "context"
+
 type ProviderVonage struct {
 	apiKey    string
 	apiSecret string
 }
 
-func (p *ProviderVonage) Send(opts SMSProviderSendOpts) error {
+func (p *ProviderVonage) Name() string {
+	return "vonage"
+}
+
+func (p *ProviderVonage) Send(
+	ctx context.Context, opts SMSProviderSendOpts,
+) (*SMSSendResult, error) {
 	// TODO: Implement this
-	return nil
+	return &SMSSendResult{}, nil
 }
@@ -0,0 +1,227 @@
+package msgr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Number of queue workers started when no count is set
+const DefaultQueueWorkers = 4
+
+// Job is a send waiting in a queue. Jobs saved to a file are stored as JSON,
+// numbers in MessageData are read back as float64.
+type Job struct {
+	ID         string
+	Opts       SendOpts
+	Attempts   int
+	EnqueuedAt time.Time
+}
+
+// Queue holds the jobs sent by the messenger workers. Implementations must be
+// safe for concurrent use.
+type Queue interface {
+	// Push adds a job to the queue
+	Push(ctx context.Context, job *Job) error
+	// Pop blocks until a job is available and counts an attempt on it. It
+	// returns ErrQueueClosed once the queue is closed and has no jobs left.
+	Pop(ctx context.Context) (*Job, error)
+	// Done is called with the outcome of sending a popped job. It is not
+	// called for sends interrupted by a Shutdown deadline, which stay pending.
+	Done(ctx context.Context, job *Job, sendErr error) error
+	// Close stops the queue from accepting new jobs
+	Close() error
+}
+
+// MemoryQueue is an unbounded in-memory Queue, jobs are lost on exit
+type MemoryQueue struct {
+	mu     sync.Mutex
+	jobs   []*Job
+	ready  chan struct{}
+	closed chan struct{}
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		ready:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) Push(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case <-q.closed:
+		return ErrQueueClosed
+	default:
+	}
+
+	q.jobs = append(q.jobs, job)
+	q.signal()
+	return nil
+}
+
+func (q *MemoryQueue) Pop(ctx context.Context) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if len(q.jobs) > 0 {
+			job := q.jobs[0]
+			job.Attempts++
+			q.jobs = q.jobs[1:]
+			if len(q.jobs) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return job, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.ready:
+		case <-q.closed:
+			// Pick up jobs pushed before closing, if any
+			q.mu.Lock()
+			empty := len(q.jobs) == 0
+			q.mu.Unlock()
+			if empty {
+				return nil, ErrQueueClosed
+			}
+		}
+	}
+}
+
+func (q *MemoryQueue) Done(ctx context.Context, job *Job, sendErr error) error {
+	return nil
+}
+
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case <-q.closed:
+	default:
+		close(q.closed)
+	}
+	return nil
+}
+
+// signal wakes up a waiting Pop, must be called with the lock held
+func (q *MemoryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue adds a send to the queue, and returns the job ID. The message is
+// sent in the background by the queue workers.
+func (msgr *Messenger) Enqueue(ctx context.Context, opts SendOpts) (string, error) {
+	if msgr.queue == nil {
+		return "", ErrNoQueue
+	}
+
+	if _, err := msgr.GetMessage(opts.MessageName); err != nil {
+		return "", err
+	}
+
+	attachments, err := resolveAttachments(opts.Attachments)
+	if err != nil {
+		return "", err
+	}
+	opts.Attachments = attachments
+
+	job := &Job{ID: newID(), Opts: opts, EnqueuedAt: time.Now()}
+	if err := msgr.queue.Push(ctx, job); err != nil {
+		return "", err
+	}
+
+	return job.ID, nil
+}
+
+// Shutdown stops the scheduler, closes the queue and waits for the workers to
+// send the jobs left. If ctx is done first, sends in flight are cancelled and
+// ctx.Err() returned. Scheduled jobs not due yet stay in the schedule store.
+func (msgr *Messenger) Shutdown(ctx context.Context) error {
+	msgr.stopScheduler()
+	msgr.stopReloader()
+
+	if msgr.queue != nil {
+		if err := msgr.queue.Close(); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		msgr.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		msgr.stopBackground()
+		return nil
+	case <-ctx.Done():
+		msgr.stopBackground()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (msgr *Messenger) startWorkers(count int) {
+	if count <= 0 {
+		count = DefaultQueueWorkers
+	}
+
+	for range count {
+		msgr.background.Add(1)
+		go func() {
+			defer msgr.background.Done()
+			msgr.work(msgr.backgroundCtx)
+		}()
+	}
+}
+
+// work sends jobs from the queue until it is closed and empty
+func (msgr *Messenger) work(ctx context.Context) {
+	for {
+		job, err := msgr.queue.Pop(ctx)
+		if errors.Is(err, ErrQueueClosed) || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Avoid spinning on a failing queue
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		_, sendErr := msgr.SendWithResult(ctx, job.Opts)
+
+		// Sends interrupted by a Shutdown deadline are not reported, so a
+		// durable queue keeps them pending and sends them after a restart
+		if sendErr != nil && ctx.Err() != nil {
+			return
+		}
+
+		// Nothing else to report the outcome to, the queue keeps track of it
+		_ = msgr.queue.Done(context.WithoutCancel(ctx), job, sendErr)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
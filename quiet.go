@@ -0,0 +1,168 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// QuietHours is a daily window, in the recipient time zone, during which
+// sends on the quiet channels are deferred until the window ends. Urgent
+// messages are never deferred.
+type QuietHours struct {
+	// Start and end of the window as time of day, such as 22 * time.Hour.
+	// The window spans midnight when Start is after End.
+	Start time.Duration
+	End   time.Duration
+	// Channels deferred, SMS and push when empty
+	Channels []Channel
+	// IANA name of the time zone used for recipients without one. Recipients
+	// without a time zone are not deferred when it is empty.
+	Timezone string
+}
+
+// Channels deferred when QuietHours.Channels is empty
+var defaultQuietChannels = []Channel{SMSChannel, PushChannel}
+
+func (q QuietHours) validate() error {
+	day := 24 * time.Hour
+	if q.Start < 0 || q.Start >= day || q.End < 0 || q.End >= day {
+		return errors.New("quiet hours start and end must be within a day")
+	}
+
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (q QuietHours) channels() []Channel {
+	if len(q.Channels) == 0 {
+		return defaultQuietChannels
+	}
+	return q.Channels
+}
+
+// until returns the end of the window if now is within it. The time of day
+// is read on the wall clock of now.
+func (q QuietHours) until(now time.Time) (time.Time, bool) {
+	hour, minute, sec := now.Clock()
+	clock := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+		time.Duration(sec)*time.Second
+
+	var quiet bool
+	if q.Start <= q.End {
+		quiet = clock >= q.Start && clock < q.End
+	} else {
+		quiet = clock >= q.Start || clock < q.End
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	year, month, day := now.Date()
+	if clock >= q.End {
+		day++
+	}
+
+	end := q.End.Truncate(time.Second)
+	endHour := int(end / time.Hour)
+	endMin := int(end % time.Hour / time.Minute)
+	endSec := int(end % time.Minute / time.Second)
+
+	until := time.Date(
+		year, month, day, endHour, endMin, endSec, 0, now.Location(),
+	)
+
+	// An end skipped by clocks going forward is read with the offset before
+	// the change, which would end the window early. Move it by the gap.
+	want := time.Date(year, month, day, endHour, endMin, endSec, 0, time.UTC)
+	got := time.Date(
+		until.Year(), until.Month(), until.Day(),
+		until.Hour(), until.Minute(), until.Second(), 0, time.UTC,
+	)
+
+	return until.Add(want.Sub(got)), true
+}
+
+// deferQuiet schedules the channels in quiet hours for when the window ends,
+// and records them in result as deferred. It returns the options to send
+// now, without the deferred recipients. Messages with a sequential delivery
+// policy are deferred as a whole, to keep their channel order.
+func (msgr *Messenger) deferQuiet(
+	ctx context.Context, msg *Message, opts SendOpts, result *SendResult,
+) (SendOpts, error) {
+	quiet, exists := msgr.quietHours[msg.category]
+	if !exists || msg.urgent {
+		return opts, nil
+	}
+
+	timezone := opts.Timezone
+	if timezone == "" {
+		timezone = quiet.Timezone
+	}
+	if timezone == "" {
+		return opts, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return opts, err
+	}
+
+	until, isQuiet := quiet.until(result.StartedAt.In(loc))
+	if !isQuiet {
+		return opts, nil
+	}
+
+	sequential := msg.deliveryPolicy.sequential()
+	quietChannels := quiet.channels()
+
+	deferred, now := opts, opts
+	for _, channel := range defaultChannelOrder {
+		quietChannel := sequential || slices.Contains(quietChannels, channel)
+		setRecipient(&deferred, channel, quietChannel)
+		setRecipient(&now, channel, !quietChannel)
+	}
+
+	sends := msgr.channelSends(deferred)
+	if len(sends) == 0 {
+		return opts, nil
+	}
+
+	deferred.SendAt = until
+	jobID, err := msgr.Schedule(ctx, deferred)
+	if err != nil {
+		return opts, err
+	}
+
+	result.JobID = jobID
+	for _, cs := range sends {
+		result.Channels = append(result.Channels, ChannelResult{
+			Channel:   cs.channel,
+			Status:    SendStatusDeferred,
+			StartedAt: result.StartedAt,
+		})
+	}
+
+	return now, nil
+}
+
+// setRecipient clears the recipient of a channel unless keep is set
+func setRecipient(opts *SendOpts, channel Channel, keep bool) {
+	if keep {
+		return
+	}
+
+	switch channel {
+	case MailChannel:
+		opts.MailTo, opts.MailToAddresses = "", nil
+		opts.MailCc, opts.MailBcc = nil, nil
+	case SMSChannel:
+		opts.SMSTo = ""
+	case PushChannel:
+		opts.PushTo = nil
+	}
+}
@@ -0,0 +1,139 @@
+package msgr
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// quietAllDay is quiet at any time of the day
+var quietAllDay = QuietHours{
+	Start:    0,
+	End:      24*time.Hour - time.Second,
+	Channels: []Channel{SMSChannel},
+	Timezone: "UTC",
+}
+
+func TestSendBatchDefersQuietChannels(t *testing.T) {
+	sms := &testSMS{}
+	store := NewMemoryScheduleStore()
+	client := newTestClient(t, ClientOpts{
+		SMSProvider:   sms,
+		ScheduleStore: store,
+		QuietHours:    map[string]QuietHours{"marketing": quietAllDay},
+		Messages: []AddMessageOpts{
+			{Name: "welcome", Category: "marketing"},
+		},
+	}, &testMail{})
+
+	result, err := client.SendBatch(context.Background(), SendBatchOpts{
+		MessageName: "welcome",
+		Recipients: []BatchRecipient{{
+			MailTo: "ada@example.com",
+			SMSTo:  "+15550100",
+			Data:   MessageData{"Name": "Ada"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := result.Results[0]
+	if status := res.Channel(SMSChannel).Status; status != SendStatusDeferred {
+		t.Errorf("got SMS status %q, want deferred", status)
+	}
+	if status := res.Channel(MailChannel).Status; status != SendStatusSent {
+		t.Errorf("got mail status %q, want sent", status)
+	}
+	if sms.count() != 0 {
+		t.Errorf("got %d SMS sent during quiet hours", sms.count())
+	}
+
+	jobs, _ := store.List(context.Background())
+	if len(jobs) != 1 || jobs[0].Opts.SMSTo != "+15550100" {
+		t.Fatalf("got scheduled jobs %+v, want the deferred SMS", jobs)
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	overnight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}
+	daytime := QuietHours{Start: 9 * time.Hour, End: 17*time.Hour + 30*time.Minute}
+
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		now   time.Time
+		until time.Time // Zero when not quiet
+	}{{
+		name:  "before midnight",
+		quiet: overnight,
+		now:   time.Date(2026, 1, 31, 23, 30, 0, 0, time.UTC),
+		until: time.Date(2026, 2, 1, 7, 0, 0, 0, time.UTC),
+	}, {
+		name:  "after midnight",
+		quiet: overnight,
+		now:   time.Date(2026, 2, 1, 2, 0, 0, 0, time.UTC),
+		until: time.Date(2026, 2, 1, 7, 0, 0, 0, time.UTC),
+	}, {
+		name:  "at start",
+		quiet: overnight,
+		now:   time.Date(2026, 2, 1, 22, 0, 0, 0, time.UTC),
+		until: time.Date(2026, 2, 2, 7, 0, 0, 0, time.UTC),
+	}, {
+		name:  "at end",
+		quiet: overnight,
+		now:   time.Date(2026, 2, 1, 7, 0, 0, 0, time.UTC),
+	}, {
+		name:  "outside overnight window",
+		quiet: overnight,
+		now:   time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC),
+	}, {
+		name:  "within daytime window",
+		quiet: daytime,
+		now:   time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+		until: time.Date(2026, 2, 1, 17, 30, 0, 0, time.UTC),
+	}, {
+		name:  "outside daytime window",
+		quiet: daytime,
+		now:   time.Date(2026, 2, 1, 23, 0, 0, 0, time.UTC),
+	}, {
+		name:  "clocks going forward",
+		quiet: overnight,
+		now:   time.Date(2026, 3, 7, 23, 0, 0, 0, newYork),
+		until: time.Date(2026, 3, 8, 7, 0, 0, 0, newYork),
+	}, {
+		name:  "clocks going back",
+		quiet: overnight,
+		now:   time.Date(2026, 10, 31, 23, 0, 0, 0, newYork),
+		until: time.Date(2026, 11, 1, 7, 0, 0, 0, newYork),
+	}, {
+		name:  "end skipped by clocks going forward",
+		quiet: QuietHours{Start: 22 * time.Hour, End: 2*time.Hour + 30*time.Minute},
+		now:   time.Date(2026, 3, 8, 1, 0, 0, 0, newYork),
+		until: time.Date(2026, 3, 8, 3, 30, 0, 0, newYork),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.quiet.until(tt.now)
+			if quiet != !tt.until.IsZero() {
+				t.Fatalf("got quiet %v at %v", quiet, tt.now)
+			}
+			if !until.Equal(tt.until) {
+				t.Errorf("got until %v, want %v", until, tt.until)
+			}
+		})
+	}
+
+	// The window ends at 7:00 local time, whatever the length of the night
+	forward, _ := overnight.until(time.Date(2026, 3, 7, 23, 0, 0, 0, newYork))
+	back, _ := overnight.until(time.Date(2026, 10, 31, 23, 0, 0, 0, newYork))
+	if forward.Hour() != 7 || back.Hour() != 7 {
+		t.Errorf("got window ends %v and %v, want 7:00", forward, back)
+	}
+}
@@ -0,0 +1,94 @@
+package msgr
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is a token bucket limit on sends
+type RateLimit struct {
+	Rate  float64 // Sends per second
+	Burst int     // Sends allowed at once, defaults to 1
+	// Wait for the limit instead of failing with ErrRateLimited. Sends that
+	// fail are retried following the retry policy of the channel.
+	Wait bool
+}
+
+type limiter struct {
+	limiter *rate.Limiter
+	wait    bool
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	return &limiter{
+		limiter: rate.NewLimiter(rate.Limit(limit.Rate), max(limit.Burst, 1)),
+		wait:    limit.Wait,
+	}
+}
+
+// take consumes n tokens, waiting for them or failing with ErrRateLimited
+// when none are available. It returns the time waited.
+func (l *limiter) take(ctx context.Context, n int) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	if !l.wait {
+		if !l.limiter.AllowN(time.Now(), n) {
+			return 0, ErrRateLimited
+		}
+		return 0, nil
+	}
+
+	// Tokens are taken one by one, as n may exceed the burst
+	startedAt := time.Now()
+	for range n {
+		if err := l.limiter.Wait(ctx); err != nil {
+			return time.Since(startedAt), err
+		}
+	}
+
+	return time.Since(startedAt), nil
+}
+
+// takeEach consumes a token for each of n sends, so a burst smaller than n
+// still lets the first sends through. It returns the error of each send, nil
+// when it is allowed, and the time waited.
+func (l *limiter) takeEach(ctx context.Context, n int) ([]error, time.Duration) {
+	errs := make([]error, n)
+
+	startedAt := time.Now()
+	for i := range n {
+		_, errs[i] = l.take(ctx, 1)
+	}
+
+	return errs, time.Since(startedAt)
+}
+
+// takeChannel consumes n tokens of the channel limit, and adds the time
+// waited to res.
+func (msgr *Messenger) takeChannel(
+	ctx context.Context, channel Channel, n int, res *ChannelResult,
+) error {
+	waited, err := msgr.channelLimiters[channel].take(ctx, n)
+	res.RateLimitWait += waited
+	return err
+}
+
+// takeProvider consumes n tokens of the provider limit, and returns the time
+// waited.
+func (msgr *Messenger) takeProvider(
+	ctx context.Context, providerName string, n int,
+) (time.Duration, error) {
+	return msgr.providerLimiters[providerName].take(ctx, n)
+}
+
+func newLimiters[K comparable](limits map[K]RateLimit) map[K]*limiter {
+	limiters := make(map[K]*limiter, len(limits))
+	for key, limit := range limits {
+		limiters[key] = newLimiter(limit)
+	}
+	return limiters
+}
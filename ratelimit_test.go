@@ -0,0 +1,79 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// testBatchMail sends mail through a batch endpoint
+type testBatchMail struct {
+	testMail
+}
+
+func (p *testBatchMail) SendBatch(
+	ctx context.Context, opts []provider.MailSendOpts,
+) ([]provider.MailBatchResult, error) {
+	results := make([]provider.MailBatchResult, len(opts))
+	for i, mailOpts := range opts {
+		res, err := p.Send(ctx, mailOpts)
+		if err != nil {
+			results[i].Error = err
+			continue
+		}
+		results[i].MessageID = res.MessageID
+	}
+	return results, nil
+}
+
+func TestLimiterTakeEachOverBurst(t *testing.T) {
+	l := newLimiter(RateLimit{Rate: 0.001, Burst: 5})
+
+	errs, _ := l.takeEach(context.Background(), 8)
+
+	for i, err := range errs {
+		if limited := errors.Is(err, ErrRateLimited); limited != (i >= 5) {
+			t.Errorf("send %d: got error %v", i, err)
+		}
+	}
+}
+
+func TestSendBatchOverBurst(t *testing.T) {
+	for _, name := range []string{"channel", "provider"} {
+		t.Run(name, func(t *testing.T) {
+			limit := RateLimit{Rate: 0.001, Burst: 5}
+			opts := ClientOpts{}
+			if name == "channel" {
+				opts.ChannelRateLimits = map[Channel]RateLimit{MailChannel: limit}
+			} else {
+				opts.ProviderRateLimits = map[string]RateLimit{"testmail": limit}
+			}
+
+			mail := &testBatchMail{}
+			opts.MailProvider = mail
+			client := newTestClient(t, opts, nil)
+
+			recipients := make([]BatchRecipient, 10)
+			for i := range recipients {
+				recipients[i] = BatchRecipient{
+					MailTo: "ada@example.com",
+					Data:   MessageData{"Name": "Ada"},
+				}
+			}
+
+			result, _ := client.SendBatch(context.Background(), SendBatchOpts{
+				MessageName: "welcome",
+				Recipients:  recipients,
+			})
+
+			if sent := mail.count(); sent != 5 {
+				t.Errorf("got %d mails sent, want 5", sent)
+			}
+			if failed := result.Failed(); failed != 5 {
+				t.Errorf("got %d recipients failed, want 5", failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package msgr
+
+import (
+	"context"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// Recipient holds the contact info of a user, channels without contact info
+// are not sent on
+type Recipient struct {
+	ID       string
+	Email    string
+	Phone    string
+	Devices  []provider.PushDevice
+	Locale   string
+	Timezone string // IANA name, such as "America/New_York"
+}
+
+// RecipientResolver looks up the contact info of a user by ID
+type RecipientResolver interface {
+	Resolve(ctx context.Context, id string) (*Recipient, error)
+}
+
+// RecipientResolverFunc adapts a function to a RecipientResolver
+type RecipientResolverFunc func(ctx context.Context, id string) (*Recipient, error)
+
+func (f RecipientResolverFunc) Resolve(
+	ctx context.Context, id string,
+) (*Recipient, error) {
+	return f(ctx, id)
+}
+
+// SendOpts returns the options to send a message to the recipient
+func (r *Recipient) SendOpts(messageName string, data MessageData) SendOpts {
+	return SendOpts{
+		MessageName: messageName,
+		RecipientID: r.ID,
+		MailTo:      r.Email,
+		SMSTo:       r.Phone,
+		PushTo:      r.Devices,
+		Data:        data,
+		Locale:      r.Locale,
+		Timezone:    r.Timezone,
+	}
+}
+
+// SendToUser resolves the contact info and locale of a user with the
+// ClientOpts.RecipientResolver, and sends the message like SendWithResult.
+func (msgr *Messenger) SendToUser(
+	ctx context.Context, userID string, messageName string, data MessageData,
+) (*SendResult, error) {
+	recipient, err := msgr.ResolveRecipient(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgr.SendWithResult(ctx, recipient.SendOpts(messageName, data))
+}
+
+// ResolveRecipient returns the contact info of a user
+func (msgr *Messenger) ResolveRecipient(
+	ctx context.Context, userID string,
+) (*Recipient, error) {
+	if msgr.recipientResolver == nil {
+		return nil, ErrNoResolver
+	}
+
+	recipient, err := msgr.recipientResolver.Resolve(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == nil {
+		return nil, ErrRecipientNotFound
+	}
+
+	return recipient, nil
+}
@@ -0,0 +1,119 @@
+package msgr
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReloadTemplates loads the layout locales and the templates and locales of
+// every message again from the TemplateSource, then swaps them in at once so
+// sends in progress keep the previous ones. Nothing is swapped when any fails
+// to load.
+func (msgr *Messenger) ReloadTemplates(ctx context.Context) error {
+	msgr.loadMu.Lock()
+	defer msgr.loadMu.Unlock()
+
+	version, err := msgr.templateSource.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := createLocaleBundle(
+		ctx, msgr.templateSource, "", msgr.defaultLocale,
+	)
+	if err != nil {
+		return err
+	}
+
+	msgr.messagesMu.RLock()
+	messages := make([]Message, 0, len(msgr.messageMap))
+	for _, msg := range msgr.messageMap {
+		messages = append(messages, msg)
+	}
+	msgr.messagesMu.RUnlock()
+
+	reloaded := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		loaded, err := msgr.loadMessage(ctx, msg.addOpts(), bundle)
+		if err != nil {
+			return fmt.Errorf("message %q: %w", msg.name, err)
+		}
+		reloaded = append(reloaded, loaded)
+	}
+
+	msgr.messagesMu.Lock()
+	msgr.layoutBundle = bundle
+	for _, msg := range reloaded {
+		msgr.messageMap[msg.name] = *msg
+	}
+	msgr.messagesMu.Unlock()
+
+	msgr.templatesVersion = version
+	return nil
+}
+
+func (msgr *Messenger) stopReloader() {
+	msgr.reloadStopOnce.Do(func() {
+		close(msgr.reloadStop)
+	})
+}
+
+func (msgr *Messenger) startReloader(
+	interval time.Duration, onError func(error),
+) {
+	msgr.background.Add(1)
+	go func() {
+		defer msgr.background.Done()
+		msgr.watchTemplates(msgr.backgroundCtx, interval, onError)
+	}()
+}
+
+// watchTemplates polls the version of the TemplateSource, and reloads the
+// templates when it changes, until the reloader is stopped.
+func (msgr *Messenger) watchTemplates(
+	ctx context.Context, interval time.Duration, onError func(error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-msgr.reloadStop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := msgr.reloadChanged(ctx); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// reloadChanged reloads the templates when the source version changed since
+// they were last loaded
+func (msgr *Messenger) reloadChanged(ctx context.Context) error {
+	version, err := msgr.templateSource.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	msgr.loadMu.Lock()
+	changed := version != msgr.templatesVersion
+	msgr.loadMu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	err = msgr.ReloadTemplates(ctx)
+	if err != nil {
+		// Reported once, the next change is reloaded
+		msgr.loadMu.Lock()
+		msgr.templatesVersion = version
+		msgr.loadMu.Unlock()
+	}
+	return err
+}
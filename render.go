@@ -2,6 +2,8 @@ package msgr
 
 import (
 	"bytes"
+	"io/fs"
+	"path"
 	"path/filepath"
 	"text/template"
 
@@ -22,6 +24,32 @@ type RenderOpts struct {
 	Locale        string
 	LayoutBundle  *i18n.Bundle
 	MessageBundle *i18n.Bundle
+	Funcs         template.FuncMap // Helpers added to or overriding the defaults
+	// Compiled template set, cloned instead of parsing Templates when set
+	Template *template.Template
+	// File system of the Templates paths, the OS file system when nil
+	FS fs.FS
+}
+
+// parse returns the template set to render, with the helpers injected
+func (opts RenderOpts) parse(funcs template.FuncMap) (*template.Template, error) {
+	if opts.Template != nil {
+		tmpl, err := opts.Template.Clone()
+		if err != nil {
+			return nil, err
+		}
+		return tmpl.Funcs(funcs).Funcs(opts.Funcs), nil
+	}
+
+	if opts.FS != nil {
+		return template.New(path.Base(opts.Templates[0])).
+			Funcs(funcs).Funcs(opts.Funcs).ParseFS(opts.FS, opts.Templates...)
+	}
+
+	tmplName := filepath.Base(opts.Templates[0])
+
+	return template.New(tmplName).
+		Funcs(funcs).Funcs(opts.Funcs).ParseFiles(opts.Templates...)
 }
 
 func RenderText(opts RenderOpts) (string, error) {
@@ -29,10 +57,7 @@ func RenderText(opts RenderOpts) (string, error) {
 		opts.LayoutBundle, opts.MessageBundle, opts.Locale,
 	)
 
-	tmplName := filepath.Base(opts.Templates[0])
-
-	tmpl, err := template.New(tmplName).
-		Funcs(funcs).ParseFiles(opts.Templates...)
+	tmpl, err := opts.parse(funcs)
 	if err != nil {
 		return "", err
 	}
@@ -50,10 +75,7 @@ func RenderHTML(opts RenderOpts) (string, error) {
 		opts.LayoutBundle, opts.MessageBundle, opts.Locale,
 	)
 
-	tmplName := filepath.Base(opts.Templates[0])
-
-	tmpl, err := template.New(tmplName).
-		Funcs(funcs).ParseFiles(opts.Templates...)
+	tmpl, err := opts.parse(funcs)
 	if err != nil {
 		return "", err
 	}
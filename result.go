@@ -0,0 +1,206 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+type SendStatus string
+
+const (
+	SendStatusSent       SendStatus = "sent"
+	SendStatusFailed     SendStatus = "failed"
+	SendStatusSkipped    SendStatus = "skipped"    // Skipped by a hook
+	SendStatusSuppressed SendStatus = "suppressed" // Recipient is suppressed
+	SendStatusDeferred   SendStatus = "deferred"   // Scheduled for quiet hours end
+)
+
+// ChannelResult is the outcome of sending a message on a single channel
+type ChannelResult struct {
+	Channel   Channel
+	Status    SendStatus
+	Provider  string                // Name of the provider which delivered
+	MessageID string                // Message ID returned by the provider
+	Devices   []provider.PushResult // Outcome for each device, push only
+	Attempts  int                   // Number of sends, including retries
+	Error     error
+	// Time spent waiting for channel and provider rate limits
+	RateLimitWait time.Duration
+	// Recipients left out as suppressed, such as mail Cc addresses or push
+	// devices. The status is suppressed when no recipient was left.
+	Suppressed []Suppression
+	// Sends made with each provider in failover order, mail and SMS only
+	ProviderAttempts []ProviderAttempt
+	StartedAt        time.Time
+	Duration         time.Duration
+}
+
+// SendResult is the outcome of sending a message on every channel attempted.
+// It satisfies error, see Err for a nil check when all channels succeeded.
+type SendResult struct {
+	MessageName string
+	Channels    []ChannelResult
+	JobID       string // Set when the send was scheduled for later
+	Duplicate   bool   // Set when returned for a repeated idempotency key
+	// Set when channels were sent on in order until one was sent, see
+	// DeliveryPolicy
+	Fallback  bool
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// Channel returns the result for a channel, or nil if it was not attempted
+func (r *SendResult) Channel(channel Channel) *ChannelResult {
+	for i := range r.Channels {
+		if r.Channels[i].Channel == channel {
+			return &r.Channels[i]
+		}
+	}
+	return nil
+}
+
+// Failed reports whether any of the channels failed. With a fallback, it
+// reports whether a channel failed and none was sent.
+func (r *SendResult) Failed() bool {
+	failed := false
+	for _, res := range r.Channels {
+		switch res.Status {
+		case SendStatusFailed:
+			failed = true
+		case SendStatusSent:
+			if r.Fallback {
+				return false
+			}
+		}
+	}
+	return failed
+}
+
+// allFailed reports whether channels were attempted and all of them failed
+func (r *SendResult) allFailed() bool {
+	for _, res := range r.Channels {
+		if res.Status != SendStatusFailed {
+			return false
+		}
+	}
+	return len(r.Channels) > 0
+}
+
+// Err returns the result as an error if any channel failed, nil otherwise
+func (r *SendResult) Err() error {
+	if !r.Failed() {
+		return nil
+	}
+	return r
+}
+
+func (r *SendResult) Error() string {
+	var msgs []string
+	for _, res := range r.Channels {
+		if res.Error != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", res.Channel, res.Error))
+		}
+	}
+	return fmt.Sprintf(
+		"send %s failed: %s", r.MessageName, strings.Join(msgs, "; "),
+	)
+}
+
+// Unwrap returns the error of each failed channel, for errors.Is and errors.As
+func (r *SendResult) Unwrap() []error {
+	var errs []error
+	for _, res := range r.Channels {
+		if res.Error != nil {
+			errs = append(errs, res.Error)
+		}
+	}
+	return errs
+}
+
+// channelSendFunc sends a message on a single channel, to the recipient of
+// event.Opts, and records the outcome in event.Result
+type channelSendFunc func(
+	ctx context.Context, msg *Message, event *HookEvent,
+) error
+
+type channelSend struct {
+	channel Channel
+	send    channelSendFunc
+}
+
+// runChannels sends on each channel concurrently, and returns the results in
+// the same order as sends.
+func (msgr *Messenger) runChannels(
+	ctx context.Context, msg *Message, opts SendOpts, sends []channelSend,
+) []ChannelResult {
+	results := make([]ChannelResult, len(sends))
+
+	var wg sync.WaitGroup
+	for i, cs := range sends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = msgr.runChannel(ctx, msg, opts, cs)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runChannel sends on a channel between its hooks
+func (msgr *Messenger) runChannel(
+	ctx context.Context, msg *Message, opts SendOpts, cs channelSend,
+) ChannelResult {
+	res := ChannelResult{Channel: cs.channel, StartedAt: time.Now()}
+	opts = opts.clone()
+	event := &HookEvent{
+		MessageName: opts.MessageName,
+		Channel:     cs.channel,
+		Opts:        &opts,
+		Result:      &res,
+	}
+
+	err := msgr.runHooks(ctx, event, beforeCompose)
+	if err == nil {
+		err = cs.send(ctx, msg, event)
+	}
+	res.finish(err)
+
+	msgr.afterDeliver(ctx, event)
+	return res
+}
+
+// finish sets the outcome of the channel
+func (res *ChannelResult) finish(err error) {
+	res.Duration = time.Since(res.StartedAt)
+
+	switch {
+	case errors.Is(err, ErrSkipChannel):
+		res.Status = SendStatusSkipped
+	case errors.Is(err, errSuppressed):
+		res.Status = SendStatusSuppressed
+	case err != nil:
+		res.Status = SendStatusFailed
+		res.Error = err
+	default:
+		res.Status = SendStatusSent
+	}
+}
+
+// MarshalJSON encodes the error as its message, so results can be saved
+func (r ChannelResult) MarshalJSON() ([]byte, error) {
+	type alias ChannelResult
+	return provider.MarshalWithError(alias(r))
+}
+
+func (r *ChannelResult) UnmarshalJSON(data []byte) error {
+	type alias ChannelResult
+	return provider.UnmarshalWithError(data, (*alias)(r))
+}
@@ -0,0 +1,83 @@
+package msgr
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+// RetryPolicy sets how a channel send is retried when the provider fails with
+// a retryable error, see provider.IsRetryable.
+type RetryPolicy struct {
+	MaxAttempts    int           // Including the first, 0 or 1 disables retries
+	InitialBackoff time.Duration // Wait before the first retry
+	MaxBackoff     time.Duration // Upper bound of the wait, 0 for no bound
+	Multiplier     float64       // Growth of the wait per retry, defaults to 2
+	Jitter         float64       // Random fraction of the wait, from 0 to 1
+}
+
+// Backoff returns the wait before a retry, counting from 1 for the first one
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 {
+		backoff = math.Min(backoff, float64(p.MaxBackoff))
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		backoff += backoff * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(backoff)
+}
+
+func (p RetryPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// wait sleeps for the backoff of a retry, or until ctx is done
+func (p RetryPolicy) wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(p.Backoff(retry))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// do calls send until it succeeds, fails with an error that is not retryable,
+// or runs out of attempts. It returns the number of attempts made.
+func (p RetryPolicy) do(ctx context.Context, send func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if !provider.IsRetryable(err) || attempt >= p.attempts() {
+			return attempt, err
+		}
+
+		if err := p.wait(ctx, attempt); err != nil {
+			return attempt, err
+		}
+	}
+}
+
+// retryPolicy returns the policy of a channel, or the default policy
+func (msgr *Messenger) retryPolicy(channel Channel) RetryPolicy {
+	if policy, exists := msgr.channelRetryPolicies[channel]; exists {
+		return policy
+	}
+	if msgr.retryPolicyDefault != nil {
+		return *msgr.retryPolicyDefault
+	}
+	return RetryPolicy{}
+}
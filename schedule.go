@@ -0,0 +1,264 @@
+package msgr
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ScheduleStore persists the jobs waiting for their SendAt time.
+// Implementations must be safe for concurrent use.
+type ScheduleStore interface {
+	Save(ctx context.Context, job *Job) error
+	// Delete removes a job, and returns ErrJobNotFound if it does not exist
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*Job, error)
+}
+
+// MemoryScheduleStore is an in-memory ScheduleStore, jobs are lost on exit
+type MemoryScheduleStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{jobs: map[string]*Job{}}
+}
+
+func (s *MemoryScheduleStore) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryScheduleStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[id]; !exists {
+		return ErrJobNotFound
+	}
+
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryScheduleStore) List(ctx context.Context) ([]*Job, error) {
+	return s.snapshot(), nil
+}
+
+// snapshot returns the jobs in no particular order
+func (s *MemoryScheduleStore) snapshot() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Collect(maps.Values(s.jobs))
+}
+
+func (s *MemoryScheduleStore) clone() *MemoryScheduleStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &MemoryScheduleStore{jobs: maps.Clone(s.jobs)}
+}
+
+// FileScheduleStore is a ScheduleStore saved as a JSON file, rewritten on
+// every change.
+type FileScheduleStore struct {
+	file *jsonFile[MemoryScheduleStore, []*Job]
+}
+
+// NewFileScheduleStore opens the store at path, creating it on first save
+func NewFileScheduleStore(path string) (*FileScheduleStore, error) {
+	jobs, err := readJSONFile[[]*Job](path)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := NewMemoryScheduleStore()
+	for _, job := range jobs {
+		mem.jobs[job.ID] = job
+	}
+
+	return &FileScheduleStore{file: newJSONFile(
+		path, mem, (*MemoryScheduleStore).clone, (*MemoryScheduleStore).snapshot,
+	)}, nil
+}
+
+func (s *FileScheduleStore) Save(ctx context.Context, job *Job) error {
+	return s.file.update(func(mem *MemoryScheduleStore) error {
+		return mem.Save(ctx, job)
+	})
+}
+
+func (s *FileScheduleStore) Delete(ctx context.Context, id string) error {
+	return s.file.update(func(mem *MemoryScheduleStore) error {
+		return mem.Delete(ctx, id)
+	})
+}
+
+func (s *FileScheduleStore) List(ctx context.Context) ([]*Job, error) {
+	return s.file.current().List(ctx)
+}
+
+// Schedule saves a send to be delivered at opts.SendAt, and returns the job
+// ID. It can be cancelled with CancelScheduled until it is due.
+func (msgr *Messenger) Schedule(ctx context.Context, opts SendOpts) (string, error) {
+	if msgr.scheduleStore == nil {
+		return "", ErrNoScheduler
+	}
+
+	if _, err := msgr.GetMessage(opts.MessageName); err != nil {
+		return "", err
+	}
+
+	attachments, err := resolveAttachments(opts.Attachments)
+	if err != nil {
+		return "", err
+	}
+	opts.Attachments = attachments
+
+	job := &Job{ID: newID(), Opts: opts, EnqueuedAt: time.Now()}
+	if err := msgr.scheduleStore.Save(ctx, job); err != nil {
+		return "", err
+	}
+
+	msgr.wakeScheduler()
+	return job.ID, nil
+}
+
+// CancelScheduled removes a scheduled send, and returns ErrJobNotFound if it
+// does not exist or was already dispatched.
+func (msgr *Messenger) CancelScheduled(ctx context.Context, id string) error {
+	if msgr.scheduleStore == nil {
+		return ErrNoScheduler
+	}
+
+	if err := msgr.scheduleStore.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	msgr.wakeScheduler()
+	return nil
+}
+
+func (msgr *Messenger) wakeScheduler() {
+	select {
+	case msgr.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+func (msgr *Messenger) stopScheduler() {
+	msgr.scheduleStopOnce.Do(func() {
+		close(msgr.scheduleStop)
+	})
+}
+
+func (msgr *Messenger) startScheduler() {
+	msgr.background.Add(1)
+	go func() {
+		defer msgr.background.Done()
+		msgr.schedule(msgr.backgroundCtx)
+	}()
+}
+
+// Longest wait before checking the store again, so jobs which failed to
+// dispatch are retried
+const schedulePollInterval = 30 * time.Second
+
+// schedule dispatches the jobs as they become due, until the scheduler is
+// stopped.
+func (msgr *Messenger) schedule(ctx context.Context) {
+	// Jobs being dispatched, so they are not dispatched twice
+	var mu sync.Mutex
+	dispatching := map[string]bool{}
+
+	for {
+		wait := schedulePollInterval
+
+		jobs, err := msgr.scheduleStore.List(ctx)
+		if err == nil {
+			slices.SortFunc(jobs, func(a, b *Job) int {
+				return a.Opts.SendAt.Compare(b.Opts.SendAt)
+			})
+
+			now := time.Now()
+			for _, job := range jobs {
+				mu.Lock()
+				skip := dispatching[job.ID]
+				mu.Unlock()
+				if skip {
+					continue
+				}
+
+				if job.Opts.SendAt.After(now) {
+					wait = min(wait, job.Opts.SendAt.Sub(now))
+					break
+				}
+
+				mu.Lock()
+				dispatching[job.ID] = true
+				mu.Unlock()
+
+				msgr.background.Add(1)
+				go func() {
+					defer msgr.background.Done()
+					msgr.dispatchScheduled(ctx, job)
+
+					mu.Lock()
+					delete(dispatching, job.ID)
+					mu.Unlock()
+				}()
+			}
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-msgr.scheduleStop:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-msgr.scheduleWake:
+		case <-timer.C:
+		}
+
+		timer.Stop()
+	}
+}
+
+// dispatchScheduled sends a due job through the queue when there is one, or
+// sends it directly, then removes it from the store. A job is kept in the
+// store until it was handed over, so it is not lost on a crash.
+func (msgr *Messenger) dispatchScheduled(ctx context.Context, job *Job) {
+	opts := job.Opts
+	opts.SendAt = time.Time{}
+	// The key was already used when scheduling
+	opts.IdempotencyKey = ""
+
+	if msgr.queue != nil {
+		queued := &Job{ID: job.ID, Opts: opts, EnqueuedAt: time.Now()}
+		if err := msgr.queue.Push(ctx, queued); err != nil {
+			return
+		}
+	} else {
+		// The outcome is in the result, there is no caller to return it to
+		_, sendErr := msgr.SendWithResult(ctx, opts)
+
+		// Sends interrupted by a Shutdown deadline are kept, and dispatched
+		// again after a restart
+		if sendErr != nil && ctx.Err() != nil {
+			return
+		}
+	}
+
+	// The job may have been cancelled meanwhile
+	_ = msgr.scheduleStore.Delete(context.WithoutCancel(ctx), job.ID)
+}
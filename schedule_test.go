@@ -0,0 +1,92 @@
+package msgr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+func TestScheduledJobInterruptedByShutdownIsKept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+
+	store, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sending := make(chan struct{})
+	mail := &testMail{send: func(
+		ctx context.Context, opts provider.MailSendOpts,
+	) error {
+		close(sending)
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	client := newTestClient(t, ClientOpts{ScheduleStore: store}, mail)
+
+	opts := welcomeOpts("ada@example.com")
+	opts.SendAt = time.Now().Add(20 * time.Millisecond)
+	if _, err := client.Schedule(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	<-sending
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Shutdown(ctx); err == nil {
+		t.Fatal("expected the shutdown deadline to be exceeded")
+	}
+
+	reopened, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := reopened.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d scheduled jobs, want 1", len(jobs))
+	}
+}
+
+func TestFileScheduleStoreUnchangedWhenWriteFails(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "schedule")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	store, err := NewFileScheduleStore(filepath.Join(dir, "schedule.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, &Job{ID: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without its directory, the file cannot be written
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(ctx, &Job{ID: "unsaved"}); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if err := store.Delete(ctx, "kept"); err == nil {
+		t.Fatal("expected the delete to fail")
+	}
+
+	jobs, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "kept" {
+		t.Errorf("got jobs %v after failed writes, want only kept", jobs)
+	}
+}
@@ -0,0 +1,480 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+type SendOpts struct {
+	MessageName string
+	RecipientID string                // Set by SendToUser, for hooks and logs
+	MailTo      string                // If MailTo is defined, it will send email
+	SMSTo       string                // If SMSTo is defined, it will send SMS
+	PushTo      []provider.PushDevice // If pushTo has devices, it will send via push
+	Data        MessageData
+	Locale      string
+	Timezone    string // IANA name of the recipient time zone
+	// If SendAt is in the future, the send is scheduled, see Schedule
+	SendAt time.Time
+	// Sends repeated with the same key return the original result instead of
+	// delivering again, see ClientOpts.DedupeStore
+	IdempotencyKey string
+
+	// Mail recipients in addition to MailTo, which may be left empty
+	MailToAddresses []provider.MailAddress
+	MailCc          []provider.MailAddress
+	MailBcc         []provider.MailAddress
+	// Files attached to the mail, readers are read before sending or queueing
+	Attachments []Attachment
+	// Mail headers and metadata, merged with those of the message
+	MailHeaders  map[string]string
+	MailMetadata map[string]string
+	// Mail tag and stream, overriding those of the message
+	MailTag           string
+	MailMessageStream string
+}
+
+// clone copies the maps and slices of opts, so hooks of concurrent channels
+// can mutate their copy. Values nested in Data are still shared.
+func (opts SendOpts) clone() SendOpts {
+	opts.PushTo = slices.Clone(opts.PushTo)
+	opts.Data = maps.Clone(opts.Data)
+	opts.MailToAddresses = slices.Clone(opts.MailToAddresses)
+	opts.MailCc = slices.Clone(opts.MailCc)
+	opts.MailBcc = slices.Clone(opts.MailBcc)
+	opts.Attachments = slices.Clone(opts.Attachments)
+	opts.MailHeaders = maps.Clone(opts.MailHeaders)
+	opts.MailMetadata = maps.Clone(opts.MailMetadata)
+	return opts
+}
+
+// Send delivers a message using a background context, see SendContext.
+func (msgr *Messenger) Send(opts SendOpts) error {
+	return msgr.SendContext(context.Background(), opts)
+}
+
+// SendContext delivers a message on every channel with a recipient defined.
+// The context is passed down to the providers, so cancellation and deadlines
+// apply to composition and delivery of each channel.
+func (msgr *Messenger) SendContext(ctx context.Context, opts SendOpts) error {
+	_, err := msgr.SendWithResult(ctx, opts)
+	return err
+}
+
+// SendWithResult delivers a message like SendContext, and reports the outcome
+// of each channel attempted. The returned error is the result itself when any
+// channel failed, so it can be inspected with errors.As.
+func (msgr *Messenger) SendWithResult(
+	ctx context.Context, opts SendOpts,
+) (*SendResult, error) {
+	return msgr.sendFunc(msgr.sendWithResult)(ctx, opts)
+}
+
+func (msgr *Messenger) sendWithResult(
+	ctx context.Context, opts SendOpts,
+) (*SendResult, error) {
+	msg, err := msgr.GetMessage(opts.MessageName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Attachments, err = resolveAttachments(opts.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IdempotencyKey != "" {
+		return msgr.dedupe(ctx, opts, func() (*SendResult, error) {
+			return msgr.send(ctx, msg, opts)
+		})
+	}
+
+	return msgr.send(ctx, msg, opts)
+}
+
+// send schedules the message when SendAt is in the future, or delivers it
+func (msgr *Messenger) send(
+	ctx context.Context, msg *Message, opts SendOpts,
+) (*SendResult, error) {
+	opts.Locale = msgr.locale(opts.Locale)
+
+	result := &SendResult{MessageName: opts.MessageName, StartedAt: time.Now()}
+
+	if opts.SendAt.After(result.StartedAt) {
+		jobID, err := msgr.Schedule(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		result.JobID = jobID
+		return result, nil
+	}
+
+	opts, err := msgr.deferQuiet(ctx, msg, opts, result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Channels are dispatched following the message delivery policy
+	delivered := msgr.deliver(ctx, msg, opts, msgr.channelSends(opts))
+	result.Channels = append(result.Channels, delivered...)
+	result.Fallback = msg.deliveryPolicy.sequential()
+	result.Duration = time.Since(result.StartedAt)
+
+	return result, result.Err()
+}
+
+// channelSends returns a send for every channel with a recipient defined
+func (msgr *Messenger) channelSends(opts SendOpts) []channelSend {
+	var sends []channelSend
+
+	// Send via email
+	if opts.MailTo != "" || len(opts.MailToAddresses) > 0 {
+		sends = append(sends, channelSend{MailChannel, msgr.sendMail})
+	}
+
+	// Send via SMS
+	if opts.SMSTo != "" {
+		sends = append(sends, channelSend{SMSChannel, msgr.sendSMS})
+	}
+
+	// Send via push
+	if len(opts.PushTo) > 0 && msgr.pushProviders != nil {
+		sends = append(sends, channelSend{PushChannel, msgr.sendPush})
+	}
+
+	return sends
+}
+
+func (msgr *Messenger) locale(locale string) string {
+	if locale == "" {
+		return msgr.defaultLocale.String()
+	}
+	return locale
+}
+
+// prepareMail composes the mail for the recipient of the event into provider
+// options, calling the compose and deliver hooks.
+func (msgr *Messenger) prepareMail(
+	ctx context.Context, msg *Message, event *HookEvent,
+) (*provider.MailSendOpts, error) {
+	opts := event.Opts
+
+	// Use the client defaults, unless the message or the send has its own
+	mailOpts := msgr.mailOpts.merge(msg.mailChannelOpts).merge(MailChannelOpts{
+		Headers:       opts.MailHeaders,
+		Tag:           opts.MailTag,
+		Metadata:      opts.MailMetadata,
+		MessageStream: opts.MailMessageStream,
+	})
+
+	to, cc, bcc, err := mailRecipients(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links are signed for a recipient, so they are left out of mails to
+	// several recipients who could unsubscribe one another
+	var unsubscribeURL string
+	if len(to) == 1 && len(cc) == 0 && len(bcc) == 0 {
+		unsubscribeURL = msgr.unsubscribeHeaders(msg, &mailOpts, to[0].Address)
+	}
+
+	contents, err := msgr.ComposeMail(ComposeMailOpts{
+		Message:        *msg,
+		Locale:         opts.Locale,
+		Data:           opts.Data,
+		UnsubscribeURL: unsubscribeURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event.Mail = contents
+	if err := msgr.runHooks(ctx, event, afterCompose); err != nil {
+		return nil, err
+	}
+
+	event.MailSendOpts = &provider.MailSendOpts{
+		To:            to,
+		Cc:            cc,
+		Bcc:           bcc,
+		From:          mailOpts.From,
+		ReplyTo:       mailOpts.ReplyTo,
+		Subject:       event.Mail.Subject,
+		HTMLBody:      event.Mail.HTMLBody,
+		TextBody:      event.Mail.TextBody,
+		Attachments:   providerAttachments(opts.Attachments),
+		Headers:       mailOpts.Headers,
+		Tag:           mailOpts.Tag,
+		Metadata:      mailOpts.Metadata,
+		MessageStream: mailOpts.MessageStream,
+	}
+	if err := msgr.runHooks(ctx, event, beforeDeliver); err != nil {
+		return nil, err
+	}
+
+	err = provider.ValidateMailHeaders(event.MailSendOpts.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	if err := msgr.suppressMail(ctx, msg, event); err != nil {
+		return nil, err
+	}
+
+	return event.MailSendOpts, nil
+}
+
+// mailRecipients returns the To, Cc and Bcc addresses of the send, and an
+// ErrInvalidAddress error if any has an invalid syntax.
+func mailRecipients(
+	opts *SendOpts,
+) (to, cc, bcc []provider.MailAddress, err error) {
+	if opts.MailTo != "" {
+		address, err := provider.ParseMailAddress(opts.MailTo)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf(
+				"%w %q: %v", ErrInvalidAddress, opts.MailTo, err,
+			)
+		}
+		to = append(to, address)
+	}
+	to = append(to, opts.MailToAddresses...)
+
+	for _, list := range [][]provider.MailAddress{to, opts.MailCc, opts.MailBcc} {
+		for _, address := range list {
+			if err := address.Validate(); err != nil {
+				return nil, nil, nil, fmt.Errorf(
+					"%w %q: %v", ErrInvalidAddress, address.Address, err,
+				)
+			}
+		}
+	}
+
+	return to, opts.MailCc, opts.MailBcc, nil
+}
+
+func (msgr *Messenger) sendMail(
+	ctx context.Context, msg *Message, event *HookEvent,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	providerOpts, err := msgr.prepareMail(ctx, msg, event)
+	if err != nil {
+		return err
+	}
+
+	res := event.Result
+	if err := msgr.takeChannel(ctx, MailChannel, 1, res); err != nil {
+		return err
+	}
+
+	return msgr.deliverMail(ctx, msgr.mailProviders, *providerOpts, res)
+}
+
+func (msgr *Messenger) sendSMS(
+	ctx context.Context, msg *Message, event *HookEvent,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	opts := event.Opts
+
+	contents, err := msgr.ComposeSMS(ComposeSMSOpts{
+		Message: *msg,
+		Locale:  opts.Locale,
+		Data:    opts.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	event.SMS = contents
+	if err := msgr.runHooks(ctx, event, afterCompose); err != nil {
+		return err
+	}
+
+	event.SMSSendOpts = &provider.SMSProviderSendOpts{
+		To:   opts.SMSTo,
+		Body: event.SMS.Body,
+	}
+	if err := msgr.runHooks(ctx, event, beforeDeliver); err != nil {
+		return err
+	}
+
+	res := event.Result
+	err = msgr.checkSuppressed(ctx, msg, SMSChannel, event.SMSSendOpts.To, res)
+	if err != nil {
+		return err
+	}
+
+	if err := msgr.takeChannel(ctx, SMSChannel, 1, res); err != nil {
+		return err
+	}
+
+	return msgr.deliverSMS(ctx, msgr.smsProviders, *event.SMSSendOpts, res)
+}
+
+func (msgr *Messenger) sendPush(
+	ctx context.Context, msg *Message, event *HookEvent,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	opts := event.Opts
+
+	contents, err := msgr.ComposePush(ComposePushOpts{
+		Message: *msg,
+		Locale:  opts.Locale,
+		Data:    opts.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	event.Push = contents
+	if err := msgr.runHooks(ctx, event, afterCompose); err != nil {
+		return err
+	}
+
+	event.PushSendOpts = &provider.PushProviderSendOpts{
+		Devices:     opts.PushTo,
+		Title:       event.Push.Title,
+		Body:        event.Push.Body,
+		Concurrency: msgr.pushConcurrency,
+	}
+	if err := msgr.runHooks(ctx, event, beforeDeliver); err != nil {
+		return err
+	}
+
+	pushOpts := *event.PushSendOpts
+	res := event.Result
+
+	devices, err := msgr.unsuppressedDevices(ctx, msg, pushOpts.Devices, res)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 && len(res.Suppressed) > 0 {
+		return errSuppressed
+	}
+
+	res.Devices = make([]provider.PushResult, len(devices))
+
+	// Rate limits are taken for each device, those over the limit are not
+	// pushed to
+	limitErrs, waited := msgr.channelLimiters[PushChannel].takeEach(
+		ctx, len(devices),
+	)
+	res.RateLimitWait += waited
+
+	// Time waited for the provider limits, by concurrent pushes
+	var providerWait atomic.Int64
+	defer func() {
+		res.RateLimitWait += time.Duration(providerWait.Load())
+	}()
+	pushOpts.Limit = func(
+		ctx context.Context, platform provider.PushPlatform, n int,
+	) error {
+		waited, err := msgr.takeProvider(ctx, string(platform), n)
+		providerWait.Add(int64(waited))
+		return err
+	}
+
+	policy := msgr.retryPolicy(PushChannel)
+
+	// Index of the devices to push to, only those that failed with a
+	// retryable error are pushed to again
+	var pending []int
+	for i, device := range devices {
+		if limitErrs[i] != nil {
+			res.Devices[i] = provider.PushResult{
+				DeviceToken: device.Token,
+				Platform:    device.Platform,
+				Error:       limitErrs[i],
+			}
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		pushOpts.Devices = make([]provider.PushDevice, len(pending))
+		for i, index := range pending {
+			pushOpts.Devices[i] = devices[index]
+		}
+
+		results, _ := msgr.pushProviders.Send(ctx, pushOpts)
+
+		res.Attempts = attempt
+		for i, index := range pending {
+			res.Devices[index] = results[i]
+		}
+
+		pending = slices.DeleteFunc(pending, func(index int) bool {
+			return !provider.IsRetryable(res.Devices[index].Error)
+		})
+		if len(pending) == 0 || attempt >= policy.attempts() {
+			break
+		}
+
+		if err := policy.wait(ctx, attempt); err != nil {
+			break
+		}
+	}
+
+	return pushErrors(res.Devices)
+}
+
+// unsuppressedDevices returns the devices which are not suppressed, and
+// records the others in res.
+func (msgr *Messenger) unsuppressedDevices(
+	ctx context.Context, msg *Message, devices []provider.PushDevice,
+	res *ChannelResult,
+) ([]provider.PushDevice, error) {
+	if msgr.suppressionStore == nil {
+		return devices, nil
+	}
+
+	var unsuppressed []provider.PushDevice
+	for _, device := range devices {
+		suppression, err := msgr.suppression(
+			ctx, msg, PushChannel, device.Token,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if suppression != nil {
+			res.Suppressed = append(res.Suppressed, *suppression)
+			continue
+		}
+		unsuppressed = append(unsuppressed, device)
+	}
+
+	return unsuppressed, nil
+}
+
+// pushErrors joins a PushSendError for each device that failed
+func pushErrors(results []provider.PushResult) error {
+	var errs []error
+	for _, res := range results {
+		if res.Error != nil {
+			errs = append(errs, &provider.PushSendError{
+				DeviceToken: res.DeviceToken, ProviderError: res.Error,
+			})
+		}
+	}
+	return errors.Join(errs...)
+}
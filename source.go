@@ -0,0 +1,265 @@
+package msgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TemplateRef identifies a layout, or a message template when MessageName is
+// set
+type TemplateRef struct {
+	MessageName string
+	Channel     Channel
+	Format      RenderFormat
+}
+
+// name returns the template file name of the directory convention, which is
+// also its name in the compiled template set
+func (ref TemplateRef) name() string {
+	kind := "index"
+	if ref.MessageName == "" {
+		kind = "layout"
+	}
+	return fmt.Sprintf("%s_%s.%s.tmpl", kind, ref.Channel, ref.Format)
+}
+
+// TemplateSource provides the layouts, message templates and locales, from
+// files, a database or an API. Empty message names refer to the layouts and
+// their locales. Implementations must be safe for concurrent use.
+type TemplateSource interface {
+	// Template returns the content of a template, or ErrTemplateNotFound
+	Template(ctx context.Context, ref TemplateRef) (string, error)
+	// Partials returns the partial templates of a message in a format, by name
+	Partials(
+		ctx context.Context, messageName string, format RenderFormat,
+	) (map[string]string, error)
+	// Locales returns the YAML locale messages of a message, by locale
+	Locales(ctx context.Context, messageName string) (map[string][]byte, error)
+	// Version changes whenever any content changes
+	Version(ctx context.Context) (string, error)
+}
+
+// FSTemplateSource reads templates from a directory of an fs.FS:
+//
+//	layout_[channel].[format].tmpl
+//	locale.[locale].yml
+//	_[partial].[format].tmpl
+//	[messageName]/index_[channel].[format].tmpl
+//	[messageName]/locale.[locale].yml
+//	[messageName]/_[partial].[format].tmpl
+type FSTemplateSource struct {
+	fsys fs.FS
+	root string
+}
+
+// NewFSTemplateSource returns a source reading from the root directory of fsys
+func NewFSTemplateSource(fsys fs.FS, root string) *FSTemplateSource {
+	if root == "" {
+		root = "."
+	}
+	return &FSTemplateSource{fsys: fsys, root: root}
+}
+
+func (s *FSTemplateSource) Template(
+	ctx context.Context, ref TemplateRef,
+) (string, error) {
+	file := path.Join(s.dir(ref.MessageName), ref.name())
+
+	content, err := fs.ReadFile(s.fsys, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, file)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+func (s *FSTemplateSource) Partials(
+	ctx context.Context, messageName string, format RenderFormat,
+) (map[string]string, error) {
+	pattern := path.Join(
+		s.dir(messageName), fmt.Sprintf("_*.%s.tmpl", format),
+	)
+
+	files, err := fs.Glob(s.fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	partials := map[string]string{}
+	for _, file := range files {
+		content, err := fs.ReadFile(s.fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		partials[path.Base(file)] = string(content)
+	}
+	return partials, nil
+}
+
+func (s *FSTemplateSource) Locales(
+	ctx context.Context, messageName string,
+) (map[string][]byte, error) {
+	files, err := fs.Glob(s.fsys, path.Join(s.dir(messageName), "locale.*.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	locales := map[string][]byte{}
+	for _, file := range files {
+		content, err := fs.ReadFile(s.fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		locale := strings.TrimSuffix(
+			strings.TrimPrefix(path.Base(file), "locale."), ".yml",
+		)
+		locales[locale] = content
+	}
+	return locales, nil
+}
+
+// Version hashes the names and contents of every file in the directory
+func (s *FSTemplateSource) Version(ctx context.Context) (string, error) {
+	hash := sha256.New()
+
+	err := fs.WalkDir(s.fsys, s.root, func(
+		file string, entry fs.DirEntry, err error,
+	) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(s.fsys, file)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(content))
+		hash.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *FSTemplateSource) dir(messageName string) string {
+	return path.Join(s.root, messageName)
+}
+
+// MemoryTemplateSource is a TemplateSource kept in memory, for templates
+// loaded from a database or an API. Every change bumps its version.
+type MemoryTemplateSource struct {
+	mu        sync.RWMutex
+	templates map[TemplateRef]string
+	partials  map[string]map[RenderFormat]map[string]string
+	locales   map[string]map[string][]byte
+	version   int
+}
+
+func NewMemoryTemplateSource() *MemoryTemplateSource {
+	return &MemoryTemplateSource{
+		templates: map[TemplateRef]string{},
+		partials:  map[string]map[RenderFormat]map[string]string{},
+		locales:   map[string]map[string][]byte{},
+	}
+}
+
+// SetTemplate sets a layout, or a message template when ref.MessageName is set
+func (s *MemoryTemplateSource) SetTemplate(ref TemplateRef, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates[ref] = content
+	s.version++
+}
+
+// SetPartial sets a partial template of a message, or shared by every message
+// when messageName is empty
+func (s *MemoryTemplateSource) SetPartial(
+	messageName string, format RenderFormat, name, content string,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.partials[messageName] == nil {
+		s.partials[messageName] = map[RenderFormat]map[string]string{}
+	}
+	if s.partials[messageName][format] == nil {
+		s.partials[messageName][format] = map[string]string{}
+	}
+
+	s.partials[messageName][format][name] = content
+	s.version++
+}
+
+// SetLocale sets the YAML locale messages of a message, or of the layouts when
+// messageName is empty
+func (s *MemoryTemplateSource) SetLocale(
+	messageName, locale string, content []byte,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locales[messageName] == nil {
+		s.locales[messageName] = map[string][]byte{}
+	}
+
+	s.locales[messageName][locale] = content
+	s.version++
+}
+
+func (s *MemoryTemplateSource) Template(
+	ctx context.Context, ref TemplateRef,
+) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	content, exists := s.templates[ref]
+	if !exists {
+		return "", fmt.Errorf(
+			"%w: %s", ErrTemplateNotFound, path.Join(ref.MessageName, ref.name()),
+		)
+	}
+	return content, nil
+}
+
+func (s *MemoryTemplateSource) Partials(
+	ctx context.Context, messageName string, format RenderFormat,
+) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return maps.Clone(s.partials[messageName][format]), nil
+}
+
+func (s *MemoryTemplateSource) Locales(
+	ctx context.Context, messageName string,
+) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return maps.Clone(s.locales[messageName]), nil
+}
+
+func (s *MemoryTemplateSource) Version(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return strconv.Itoa(s.version), nil
+}
@@ -0,0 +1,236 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+type SuppressionReason string
+
+const (
+	SuppressionBounce      SuppressionReason = "bounce"
+	SuppressionComplaint   SuppressionReason = "complaint"
+	SuppressionUnsubscribe SuppressionReason = "unsubscribe"
+	SuppressionManual      SuppressionReason = "manual"
+)
+
+// Suppression stops sends on a channel to an address, which is an email,
+// phone number or push device token. Unsubscribe suppressions only stop the
+// messages of the UnsubscribeOpts categories.
+type Suppression struct {
+	Channel     Channel
+	Address     string
+	Reason      SuppressionReason
+	MessageName string // Message unsubscribed from, if any
+	CreatedAt   time.Time
+}
+
+// SuppressionStore is consulted before delivering on each channel.
+// Implementations must be safe for concurrent use.
+type SuppressionStore interface {
+	// Get returns the suppression of an address, or nil if there is none
+	Get(ctx context.Context, channel Channel, address string) (*Suppression, error)
+	Add(ctx context.Context, suppression Suppression) error
+	Remove(ctx context.Context, channel Channel, address string) error
+}
+
+// errSuppressed is returned by a channel send when the recipient is
+// suppressed, and sets the status of the channel
+var errSuppressed = errors.New("recipient suppressed")
+
+// suppressionKey normalizes the address, email addresses are case insensitive
+func suppressionKey(channel Channel, address string) string {
+	address = strings.TrimSpace(address)
+	if channel == MailChannel {
+		address = strings.ToLower(address)
+	}
+	return string(channel) + ":" + address
+}
+
+// MemorySuppressionStore is an in-memory SuppressionStore
+type MemorySuppressionStore struct {
+	mu           sync.Mutex
+	suppressions map[string]Suppression
+}
+
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{suppressions: map[string]Suppression{}}
+}
+
+func (s *MemorySuppressionStore) Get(
+	ctx context.Context, channel Channel, address string,
+) (*Suppression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suppression, exists := s.suppressions[suppressionKey(channel, address)]
+	if !exists {
+		return nil, nil
+	}
+	return &suppression, nil
+}
+
+func (s *MemorySuppressionStore) Add(
+	ctx context.Context, suppression Suppression,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now()
+	}
+
+	key := suppressionKey(suppression.Channel, suppression.Address)
+	s.suppressions[key] = suppression
+	return nil
+}
+
+func (s *MemorySuppressionStore) Remove(
+	ctx context.Context, channel Channel, address string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.suppressions, suppressionKey(channel, address))
+	return nil
+}
+
+// snapshot returns the suppressions in no particular order
+func (s *MemorySuppressionStore) snapshot() []Suppression {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Collect(maps.Values(s.suppressions))
+}
+
+func (s *MemorySuppressionStore) clone() *MemorySuppressionStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &MemorySuppressionStore{suppressions: maps.Clone(s.suppressions)}
+}
+
+// FileSuppressionStore is a SuppressionStore saved as a JSON file, rewritten
+// on every change.
+type FileSuppressionStore struct {
+	file *jsonFile[MemorySuppressionStore, []Suppression]
+}
+
+// NewFileSuppressionStore opens the store at path, creating it on first add
+func NewFileSuppressionStore(path string) (*FileSuppressionStore, error) {
+	suppressions, err := readJSONFile[[]Suppression](path)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := NewMemorySuppressionStore()
+	for _, suppression := range suppressions {
+		key := suppressionKey(suppression.Channel, suppression.Address)
+		mem.suppressions[key] = suppression
+	}
+
+	return &FileSuppressionStore{file: newJSONFile(
+		path, mem,
+		(*MemorySuppressionStore).clone, (*MemorySuppressionStore).snapshot,
+	)}, nil
+}
+
+func (s *FileSuppressionStore) Get(
+	ctx context.Context, channel Channel, address string,
+) (*Suppression, error) {
+	return s.file.current().Get(ctx, channel, address)
+}
+
+func (s *FileSuppressionStore) Add(
+	ctx context.Context, suppression Suppression,
+) error {
+	return s.file.update(func(mem *MemorySuppressionStore) error {
+		return mem.Add(ctx, suppression)
+	})
+}
+
+func (s *FileSuppressionStore) Remove(
+	ctx context.Context, channel Channel, address string,
+) error {
+	return s.file.update(func(mem *MemorySuppressionStore) error {
+		return mem.Remove(ctx, channel, address)
+	})
+}
+
+// suppression returns the suppression of the address which applies to the
+// message, or nil if there is none
+func (msgr *Messenger) suppression(
+	ctx context.Context, msg *Message, channel Channel, address string,
+) (*Suppression, error) {
+	if msgr.suppressionStore == nil {
+		return nil, nil
+	}
+
+	suppression, err := msgr.suppressionStore.Get(ctx, channel, address)
+	if err != nil || suppression == nil {
+		return nil, err
+	}
+
+	if suppression.Reason == SuppressionUnsubscribe && !msgr.unsubscribable(msg) {
+		return nil, nil
+	}
+	return suppression, nil
+}
+
+// checkSuppressed returns errSuppressed and records the suppression in res
+// when the address is suppressed on the channel.
+func (msgr *Messenger) checkSuppressed(
+	ctx context.Context, msg *Message, channel Channel, address string,
+	res *ChannelResult,
+) error {
+	suppression, err := msgr.suppression(ctx, msg, channel, address)
+	if err != nil {
+		return err
+	}
+
+	if suppression != nil {
+		res.Suppressed = append(res.Suppressed, *suppression)
+		return errSuppressed
+	}
+	return nil
+}
+
+// suppressMail leaves out the suppressed mail recipients of the event, and
+// returns errSuppressed when no To address is left.
+func (msgr *Messenger) suppressMail(
+	ctx context.Context, msg *Message, event *HookEvent,
+) error {
+	if msgr.suppressionStore == nil {
+		return nil
+	}
+
+	opts := event.MailSendOpts
+	for _, list := range []*[]provider.MailAddress{&opts.To, &opts.Cc, &opts.Bcc} {
+		var kept []provider.MailAddress
+		for _, address := range *list {
+			err := msgr.checkSuppressed(
+				ctx, msg, MailChannel, address.Address, event.Result,
+			)
+			if errors.Is(err, errSuppressed) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			kept = append(kept, address)
+		}
+		*list = kept
+	}
+
+	if len(opts.To) == 0 {
+		return errSuppressed
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+func TestEmptyPushDevicesAreNotSent(t *testing.T) {
+	client := newTestClient(t, ClientOpts{
+		PushProviders: &provider.PushProviders{},
+	}, &testMail{})
+
+	opts := welcomeOpts("ada@example.com")
+	opts.PushTo = []provider.PushDevice{}
+
+	res, err := client.SendWithResult(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if push := res.Channel(PushChannel); push != nil {
+		t.Fatalf("got push result %+v, want no push channel", push)
+	}
+}
+
+// newSuppressionClient returns a client with the addresses suppressed
+func newSuppressionClient(
+	t *testing.T, mail *testMail, suppressions ...Suppression,
+) *Messenger {
+	t.Helper()
+
+	store := NewMemorySuppressionStore()
+	for _, suppression := range suppressions {
+		if err := store.Add(context.Background(), suppression); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return newTestClient(t, ClientOpts{
+		SuppressionStore: store,
+		PushProviders:    &provider.PushProviders{},
+	}, mail)
+}
+
+func TestSuppressedMailRecipient(t *testing.T) {
+	mail := &testMail{}
+	client := newSuppressionClient(t, mail, Suppression{
+		Channel: MailChannel, Address: "Ada@Example.com",
+		Reason: SuppressionBounce,
+	})
+
+	res, err := client.SendWithResult(
+		context.Background(), welcomeOpts("ada@example.com"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailRes := res.Channel(MailChannel)
+	if mailRes.Status != SendStatusSuppressed || len(mailRes.Suppressed) != 1 ||
+		mailRes.Suppressed[0].Reason != SuppressionBounce {
+		t.Errorf("got mail result %+v, want suppressed by the bounce", mailRes)
+	}
+	if mail.count() != 0 {
+		t.Errorf("got %d mails sent to a suppressed address", mail.count())
+	}
+}
+
+func TestSuppressedCcAndBccAreLeftOut(t *testing.T) {
+	mail := &testMail{}
+	client := newSuppressionClient(t, mail, Suppression{
+		Channel: MailChannel, Address: "bob@example.com",
+		Reason: SuppressionComplaint,
+	}, Suppression{
+		Channel: MailChannel, Address: "eve@example.com", Reason: SuppressionManual,
+	})
+
+	opts := welcomeOpts("ada@example.com")
+	opts.MailCc = []provider.MailAddress{
+		{Address: "bob@example.com"}, {Address: "carol@example.com"},
+	}
+	opts.MailBcc = []provider.MailAddress{{Address: "eve@example.com"}}
+
+	res, err := client.SendWithResult(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailRes := res.Channel(MailChannel)
+	if mailRes.Status != SendStatusSent || len(mailRes.Suppressed) != 2 {
+		t.Errorf("got mail result %+v, want sent with 2 suppressed", mailRes)
+	}
+	if mail.count() != 1 {
+		t.Fatalf("got %d mails, want 1", mail.count())
+	}
+	sent := mail.sent[0]
+	if len(sent.Cc) != 1 || sent.Cc[0].Address != "carol@example.com" ||
+		len(sent.Bcc) != 0 {
+		t.Errorf("got Cc %v and Bcc %v, want only carol in Cc",
+			sent.Cc, sent.Bcc)
+	}
+}
+
+func TestSuppressedPushDevicesAreLeftOut(t *testing.T) {
+	client := newSuppressionClient(t, &testMail{}, Suppression{
+		Channel: PushChannel, Address: "suppressed", Reason: SuppressionManual,
+	})
+	ctx := context.Background()
+
+	opts := SendOpts{
+		MessageName: "welcome",
+		PushTo: []provider.PushDevice{
+			{Token: "suppressed", Platform: provider.PushPlatformApple},
+			{Token: "kept", Platform: provider.PushPlatformApple},
+		},
+		Data: MessageData{"Name": "Ada"},
+	}
+	res, _ := client.SendWithResult(ctx, opts)
+
+	// The kept device is pushed to, and fails as Apple has no provider
+	push := res.Channel(PushChannel)
+	if len(push.Suppressed) != 1 || push.Suppressed[0].Address != "suppressed" {
+		t.Errorf("got suppressed %+v, want the suppressed device",
+			push.Suppressed)
+	}
+	if len(push.Devices) != 1 || push.Devices[0].DeviceToken != "kept" ||
+		!errors.Is(push.Devices[0].Error, provider.ErrPlatformNotConfigured) {
+		t.Errorf("got devices %+v, want only the kept device", push.Devices)
+	}
+
+	opts.PushTo = opts.PushTo[:1]
+	res, err := client.SendWithResult(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := res.Channel(PushChannel).Status; status != SendStatusSuppressed {
+		t.Errorf("got status %q with every device suppressed, want suppressed",
+			status)
+	}
+}
+
+func TestFileSuppressionStoreKeepsReasons(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+	ctx := context.Background()
+
+	store, err := NewFileSuppressionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suppressions := []Suppression{
+		{
+			Channel: MailChannel, Address: "bounced@example.com",
+			Reason: SuppressionBounce,
+		},
+		{Channel: SMSChannel, Address: "+15550100", Reason: SuppressionComplaint},
+		{
+			Channel: MailChannel, Address: "left@example.com",
+			Reason: SuppressionUnsubscribe, MessageName: "weeklyDigest",
+		},
+	}
+	for _, suppression := range suppressions {
+		if err := store.Add(ctx, suppression); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := NewFileSuppressionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range suppressions {
+		got, err := reopened.Get(ctx, want.Channel, want.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Reason != want.Reason ||
+			got.MessageName != want.MessageName || got.CreatedAt.IsZero() {
+			t.Errorf("got %+v for %s, want reason %s",
+				got, want.Address, want.Reason)
+		}
+	}
+}
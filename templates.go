@@ -0,0 +1,116 @@
+package msgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"text/template"
+)
+
+// templateKey identifies the template set composing a channel in a format
+type templateKey struct {
+	channel Channel
+	format  RenderFormat
+}
+
+// Template sets compiled for each message
+var templateKeys = []templateKey{
+	{MailChannel, RenderKindHTML},
+	{MailChannel, RenderKindText},
+	{SMSChannel, RenderKindText},
+	{PushChannel, RenderKindText},
+}
+
+// messageTemplate returns the compiled template set composing a channel
+func (msgr *Messenger) messageTemplate(
+	msg *Message, channel Channel, format RenderFormat,
+) (*template.Template, error) {
+	tmpl := msg.template(channel, format)
+	if tmpl == nil {
+		return nil, fmt.Errorf(
+			"%w: %s %s %s", ErrTemplateNotFound, msg.name, channel, format,
+		)
+	}
+	return tmpl, nil
+}
+
+// compileTemplates parses the template sets of the message once, so renders
+// only clone them. Sets with a missing layout or message template are left
+// out, and fail with ErrTemplateNotFound when rendered.
+func (msgr *Messenger) compileTemplates(
+	ctx context.Context, msg *Message,
+) (map[templateKey]*template.Template, error) {
+	templates := map[templateKey]*template.Template{}
+
+	for _, key := range templateKeys {
+		tmpl, err := msgr.compileTemplate(ctx, msg, key)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		templates[key] = tmpl
+	}
+
+	return templates, nil
+}
+
+// compileTemplate parses the layout, the message template, the shared partials
+// and the message partials of a channel, in that order, so the message
+// partials override shared ones of the same name
+func (msgr *Messenger) compileTemplate(
+	ctx context.Context, msg *Message, key templateKey,
+) (*template.Template, error) {
+	layoutRef := TemplateRef{Channel: key.channel, Format: key.format}
+	layout, err := msgr.templateSource.Template(ctx, layoutRef)
+	if err != nil {
+		return nil, err
+	}
+
+	// SMS bodies are rendered from the mail text templates of the message
+	msgRef := TemplateRef{
+		MessageName: msg.name, Channel: key.channel, Format: key.format,
+	}
+	if key.channel == SMSChannel {
+		msgRef.Channel = MailChannel
+	}
+
+	index, err := msgr.templateSource.Template(ctx, msgRef)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := textTemplateHelpers(nil, nil, "")
+	if key.format == RenderKindHTML {
+		funcs = htmlTemplateHelpers(nil, nil, "")
+	}
+
+	tmpl, err := template.New(layoutRef.name()).Funcs(funcs).Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.New(msgRef.name()).Parse(index); err != nil {
+		return nil, err
+	}
+
+	for _, messageName := range []string{"", msg.name} {
+		partials, err := msgr.templateSource.Partials(
+			ctx, messageName, key.format,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(partials)) {
+			if _, err := tmpl.New(name).Parse(partials[name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,35 @@
+package msgr
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMessagePartialsOverrideSharedPartials(t *testing.T) {
+	source := testTemplates()
+	source.SetTemplate(TemplateRef{
+		MessageName: "welcome", Channel: MailChannel, Format: RenderKindText,
+	}, `{{ define "content" }}{{ template "footer" }}{{ end }}`)
+	source.SetPartial(
+		"", RenderKindText, "_footer.text.tmpl",
+		`{{ define "footer" }}SHARED{{ end }}`,
+	)
+	source.SetPartial(
+		"welcome", RenderKindText, "_footer.text.tmpl",
+		`{{ define "footer" }}MESSAGE{{ end }}`,
+	)
+
+	mail := &testMail{}
+	client := newTestClient(t, ClientOpts{TemplateSource: source}, mail)
+
+	if _, err := client.SendWithResult(
+		context.Background(), welcomeOpts("ada@example.com"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := mail.sent[0].TextBody; !strings.Contains(body, "MESSAGE") {
+		t.Errorf("got body %q, want the message footer", body)
+	}
+}
@@ -0,0 +1,214 @@
+package msgr
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UnsubscribeOpts enables one-click unsubscribe links, see RFC 8058. Mails of
+// the unsubscribe categories get List-Unsubscribe headers, and their templates
+// can link to the unsubscribeURL helper.
+type UnsubscribeOpts struct {
+	// Key signing the unsubscribe tokens, keep it secret
+	Secret []byte
+	// URL where UnsubscribeHandler is served, the token is added to its query
+	URL string
+	// Message categories recipients can unsubscribe from, all when empty
+	Categories []string
+}
+
+func (o *UnsubscribeOpts) validate() error {
+	if len(o.Secret) == 0 {
+		return errors.New("unsubscribe secret is empty")
+	}
+
+	if _, err := url.Parse(o.URL); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unsubscribeToken is the payload of a token
+type unsubscribeToken struct {
+	Address     string `json:"a"`
+	MessageName string `json:"m"`
+}
+
+// unsubscribable reports whether recipients can unsubscribe from the message.
+// Unsubscribe suppressions only apply to these messages.
+func (msgr *Messenger) unsubscribable(msg *Message) bool {
+	if msgr.unsubscribe == nil {
+		return true
+	}
+
+	categories := msgr.unsubscribe.Categories
+	return len(categories) == 0 || slices.Contains(categories, msg.category)
+}
+
+// UnsubscribeToken returns a token signed for the mail address and message
+func (msgr *Messenger) UnsubscribeToken(address, messageName string) string {
+	payload, _ := json.Marshal(unsubscribeToken{
+		Address: address, MessageName: messageName,
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + msgr.signUnsubscribe(encoded)
+}
+
+// UnsubscribeURL returns the unsubscribe link of the mail address and message,
+// or an empty string when unsubscribe links are not enabled.
+func (msgr *Messenger) UnsubscribeURL(address, messageName string) string {
+	if msgr.unsubscribe == nil {
+		return ""
+	}
+
+	link, err := url.Parse(msgr.unsubscribe.URL)
+	if err != nil {
+		return ""
+	}
+
+	query := link.Query()
+	query.Set("token", msgr.UnsubscribeToken(address, messageName))
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+func (msgr *Messenger) signUnsubscribe(encoded string) string {
+	mac := hmac.New(sha256.New, msgr.unsubscribe.Secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyUnsubscribe returns the payload of a token, or ErrInvalidToken
+func (msgr *Messenger) verifyUnsubscribe(token string) (*unsubscribeToken, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || msgr.unsubscribe == nil {
+		return nil, ErrInvalidToken
+	}
+
+	expected := msgr.signUnsubscribe(encoded)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var parsed unsubscribeToken
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &parsed, nil
+}
+
+// Unsubscribe verifies a token and records the opt-out of its mail address in
+// the suppression store. A bounce, complaint or manual suppression of the
+// address is kept, as it stops every message and not only unsubscribable ones.
+func (msgr *Messenger) Unsubscribe(ctx context.Context, token string) error {
+	parsed, err := msgr.verifyUnsubscribe(token)
+	if err != nil {
+		return err
+	}
+
+	existing, err := msgr.suppressionStore.Get(ctx, MailChannel, parsed.Address)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Reason != SuppressionUnsubscribe {
+		return nil
+	}
+
+	return msgr.suppressionStore.Add(ctx, Suppression{
+		Channel:     MailChannel,
+		Address:     parsed.Address,
+		Reason:      SuppressionUnsubscribe,
+		MessageName: parsed.MessageName,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// unsubscribeHeaders adds the one-click List-Unsubscribe headers to the mail
+// of an unsubscribable message, and returns the unsubscribe URL of the address.
+func (msgr *Messenger) unsubscribeHeaders(
+	msg *Message, mailOpts *MailChannelOpts, address string,
+) string {
+	if msgr.unsubscribe == nil || !msgr.unsubscribable(msg) {
+		return ""
+	}
+
+	unsubscribeURL := msgr.UnsubscribeURL(address, msg.name)
+	mailOpts.Headers = mergeStrings(mailOpts.Headers, map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	})
+	return unsubscribeURL
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(
+	`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{- if .Done }}
+<p>You have been unsubscribed.</p>
+{{- else }}
+<form method="post">
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">Unsubscribe</button>
+</form>
+{{- end }}
+</body>
+</html>
+`))
+
+// UnsubscribeHandler serves the unsubscribe links. One-click POST requests
+// from mail clients and the confirmation form record the opt-out, while GET
+// requests show the form, so link scanners do not unsubscribe recipients.
+func (msgr *Messenger) UnsubscribeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+
+		switch r.Method {
+		case http.MethodGet:
+			if _, err := msgr.verifyUnsubscribe(token); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			err := msgr.Unsubscribe(r.Context(), token)
+			if errors.Is(err, ErrInvalidToken) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unsubscribe failed", http.StatusInternalServerError)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = unsubscribePage.Execute(w, map[string]any{
+			"Token": token,
+			"Done":  r.Method == http.MethodPost,
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package msgr
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fyrolabs/fyro-msgr/provider"
+)
+
+func newUnsubscribeClient(t *testing.T, mail *testMail) *Messenger {
+	t.Helper()
+
+	return newTestClient(t, ClientOpts{
+		SuppressionStore: NewMemorySuppressionStore(),
+		Unsubscribe: &UnsubscribeOpts{
+			Secret: []byte("secret"),
+			URL:    "https://example.org/unsubscribe",
+		},
+	}, mail)
+}
+
+func TestUnsubscribeHeaderOnlyForSingleRecipient(t *testing.T) {
+	mail := &testMail{}
+	client := newUnsubscribeClient(t, mail)
+	ctx := context.Background()
+
+	if _, err := client.SendWithResult(
+		ctx, welcomeOpts("ada@example.com"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := welcomeOpts("ada@example.com")
+	opts.MailCc = []provider.MailAddress{{Address: "bob@example.com"}}
+	if _, err := client.SendWithResult(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists := mail.sent[0].Headers["List-Unsubscribe"]; !exists {
+		t.Errorf("got no List-Unsubscribe header for a single recipient")
+	}
+	if header, exists := mail.sent[1].Headers["List-Unsubscribe"]; exists {
+		t.Errorf("got List-Unsubscribe %q for several recipients", header)
+	}
+}
+
+func TestUnsubscribeTokenVerification(t *testing.T) {
+	client := newUnsubscribeClient(t, &testMail{})
+	token := client.UnsubscribeToken("ada@example.com", "welcome")
+
+	parsed, err := client.verifyUnsubscribe(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Address != "ada@example.com" || parsed.MessageName != "welcome" {
+		t.Errorf("got payload %+v", parsed)
+	}
+
+	encoded, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"a":"bob@example.com","m":"welcome"}`),
+	)
+	other := &Messenger{
+		unsubscribe: &UnsubscribeOpts{Secret: []byte("other secret")},
+	}
+
+	invalid := map[string]string{
+		"empty":             "",
+		"no signature":      encoded,
+		"changed payload":   forged + "." + signature,
+		"changed signature": encoded + "." + strings.ToUpper(signature),
+		"other secret":      other.UnsubscribeToken("ada@example.com", "welcome"),
+		"signed garbage":    "e30x." + client.signUnsubscribe("e30x"),
+	}
+	for name, token := range invalid {
+		if _, err := client.verifyUnsubscribe(token); !errors.Is(
+			err, ErrInvalidToken,
+		) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestUnsubscribeHandler(t *testing.T) {
+	client := newUnsubscribeClient(t, &testMail{})
+	handler := client.UnsubscribeHandler()
+	ctx := context.Background()
+
+	link, err := url.Parse(client.UnsubscribeURL("ada@example.com", "welcome"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suppressed := func() bool {
+		suppression, err := client.suppressionStore.Get(
+			ctx, MailChannel, "ada@example.com",
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return suppression != nil
+	}
+
+	// Link scanners following the link do not unsubscribe
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link.String(), nil))
+	if rec.Code != http.StatusOK || suppressed() {
+		t.Fatalf("GET: got status %d, suppressed %v", rec.Code, suppressed())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(
+		http.MethodPost, link.String()+"x", nil,
+	))
+	if rec.Code != http.StatusBadRequest || suppressed() {
+		t.Fatalf("invalid POST: got status %d, suppressed %v",
+			rec.Code, suppressed())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, link.String(), nil))
+	if rec.Code != http.StatusOK || !suppressed() {
+		t.Errorf("POST: got status %d, suppressed %v", rec.Code, suppressed())
+	}
+}
+
+func TestUnsubscribeKeepsStrongerSuppression(t *testing.T) {
+	client := newUnsubscribeClient(t, &testMail{})
+	ctx := context.Background()
+
+	for _, reason := range []SuppressionReason{
+		SuppressionBounce, SuppressionComplaint, SuppressionManual,
+	} {
+		if err := client.suppressionStore.Add(ctx, Suppression{
+			Channel: MailChannel, Address: "ada@example.com", Reason: reason,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		token := client.UnsubscribeToken("ada@example.com", "welcome")
+		if err := client.Unsubscribe(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+
+		suppression, err := client.suppressionStore.Get(
+			ctx, MailChannel, "ada@example.com",
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suppression == nil || suppression.Reason != reason {
+			t.Errorf("got %+v after unsubscribing, want reason %s",
+				suppression, reason)
+		}
+	}
+}